@@ -0,0 +1,156 @@
+package bankrecover
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// Summary is a summary of a replay and the banks recovered from it.
+type Summary struct {
+	Title    string          `json:"title"`
+	Version  string          `json:"version"`
+	Loops    int64           `json:"loops"`
+	Duration string          `json:"duration"`
+	Author   string          `json:"author"` // toon handle of the map author, see Bank.AuthorToon
+	Players  []SummaryPlayer `json:"players"`
+}
+
+// SummaryPlayer is a player in a Summary.
+type SummaryPlayer struct {
+	Index int      `json:"index"` // player index of NewBanksFromReplay
+	Toon  string   `json:"toon"`
+	Name  string   `json:"name"`
+	Banks []string `json:"banks"`
+}
+
+// NewSummary returns the summary of the replay 'r' and the banks 'banks' recovered from it.
+// Players without banks are left out.
+func NewSummary(r *repm.Rep, banks []map[string]*Bank) Summary {
+	ret := Summary{
+		Title:    r.Details.Title(),
+		Version:  r.Header.VersionString(),
+		Loops:    r.Header.Loops(),
+		Duration: r.Header.Duration().String(),
+		Author:   r.InitData.GameDescription.MapAuthorName(),
+		Players:  []SummaryPlayer{},
+	}
+	for iPlayer, playerBanks := range banks {
+		names := sortedBankNames(playerBanks)
+		if len(names) == 0 {
+			continue
+		}
+		bank := playerBanks[names[0]]
+		ret.Players = append(ret.Players, SummaryPlayer{
+			Index: iPlayer,
+			Toon:  bank.UserSlot.ToonHandle(),
+			Name:  bank.PlayerName(),
+			Banks: names,
+		})
+	}
+	return ret
+}
+
+// WriteArchiveTarGz writes a gzip-compressed tar archive of the banks 'banks' recovered from the replay 'r'
+// to the writer 'w'. Each bank is an entry "<iPlayer>__<toon>/<bank name>.SC2Bank" written by Bank.WriteTo,
+// next to a "summary.json" entry holding the Summary of the replay.
+func WriteArchiveTarGz(w io.Writer, r *repm.Rep, banks []map[string]*Bank) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	add := func(name string, content []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: Now(),
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+
+	summary, err := json.MarshalIndent(NewSummary(r, banks), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add("summary.json", summary); err != nil {
+		return err
+	}
+	for iPlayer, playerBanks := range banks {
+		for _, name := range sortedBankNames(playerBanks) {
+			buf := &bytes.Buffer{}
+			if _, err := playerBanks[name].WriteTo(buf); err != nil {
+				return err
+			}
+			if err := add(archivePath(iPlayer, playerBanks[name]), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// WriteArchiveZip writes a zip archive of the banks 'banks' to the writer 'w'.
+// Each bank is an entry "<iPlayer>__<toon>/<bank name>.SC2Bank" written by Bank.WriteTo,
+// named as in WriteArchiveTarGz. Entries are in player index, then bank name order.
+func WriteArchiveZip(w io.Writer, banks []map[string]*Bank) error {
+	zw := zip.NewWriter(w)
+	for iPlayer, playerBanks := range banks {
+		for _, name := range sortedBankNames(playerBanks) {
+			fw, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     archivePath(iPlayer, playerBanks[name]),
+				Method:   zip.Deflate,
+				Modified: Now(),
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := playerBanks[name].WriteTo(fw); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// archivePath returns the slash-separated path of the bank 'bank' of the player 'iPlayer' in archives.
+// It is laid out after DefaultPathTemplate, as the banks are saved.
+func archivePath(iPlayer int, bank *Bank) string {
+	p, _ := ExpandPathTemplate(DefaultPathTemplate, bank, iPlayer) // never fails of the default template
+	return p
+}
+
+// SanitizeBankFilename returns the bank name 'name' made safe to be a file name on any file system,
+// under the rules of the paths this package lays banks out in: path separators and characters illegal
+// in Windows file names are replaced with '_', and names escaping the directory like "." and ".." are prefixed with '_'.
+// The same name always gives the same file name.
+func SanitizeBankFilename(name string) string {
+	return sanitizePathElem(name)
+}
+
+// sanitizePathElem returns 'elem' made safe to be a single element of a path on any file system.
+// Path separators and characters illegal in Windows file names are replaced with '_',
+// and names escaping the directory like "." and ".." are prefixed with '_'.
+func sanitizePathElem(elem string) string {
+	elem = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, elem)
+	if elem == "" || strings.Trim(elem, ".") == "" {
+		elem = "_" + elem
+	}
+	return elem
+}
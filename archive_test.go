@@ -0,0 +1,153 @@
+package bankrecover
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+)
+
+func TestSanitizePathElem(t *testing.T) {
+	cases := []struct {
+		elem, sanitized string
+	}{
+		{"GalaxyData", "GalaxyData"},
+		{"a/b\\c", "a_b_c"},
+		{`x:y*z?"<>|`, "x_y_z_____"},
+		{".", "_."},
+		{"..", "_.."},
+		{"", "_"},
+		{"v1.2", "v1.2"},
+	}
+
+	for _, c := range cases {
+		if got := sanitizePathElem(c.elem); got != c.sanitized {
+			t.Errorf("Expected: %v, got: %v", c.sanitized, got)
+		}
+	}
+}
+
+func TestSanitizeBankFilename(t *testing.T) {
+	cases := []struct {
+		name, sanitized string
+	}{
+		{"Progress", "Progress"},
+		{"Save:1*?", "Save_1__"},
+		{"../x", ".._x"},
+		{"..", "_.."},
+	}
+	for _, c := range cases {
+		if got := SanitizeBankFilename(c.name); got != c.sanitized {
+			t.Errorf("Expected: %v, got: %v", c.sanitized, got)
+		}
+	}
+}
+
+func TestWriteArchiveTarGz(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "../Evil"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+	)
+	buf := &bytes.Buffer{}
+	if err := WriteArchiveTarGz(buf, r, NewBanksFromReplay(r)); err != nil {
+		t.Fatal(err)
+	}
+
+	gr, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	cases := []string{"summary.json", "0__1-S2-1-1/.._Evil.SC2Bank"}
+	if len(names) != len(cases) {
+		t.Fatalf("Expected: %v, got: %v", cases, names)
+	}
+	for i, c := range cases {
+		if names[i] != c {
+			t.Errorf("Expected: %v, got: %v", c, names[i])
+		}
+	}
+}
+
+func TestWriteArchiveZip(t *testing.T) {
+	defer func(now func() time.Time) { Now = now }(Now)
+	pinned := time.Date(2022, 1, 12, 0, 0, 0, 0, time.UTC)
+	Now = func() time.Time { return pinned }
+
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("B", 2, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "../Evil"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Other"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "A:B"),
+	)
+	banks := NewBanksFromReplay(r)
+	buf := &bytes.Buffer{}
+	if err := WriteArchiveZip(buf, banks); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		bank *Bank
+	}{
+		{"0__1-S2-1-1/.._Evil.SC2Bank", banks[0]["../Evil"]},
+		{"0__1-S2-1-1/A_B.SC2Bank", banks[0]["A:B"]},
+		{"1__1-S2-1-2/Other.SC2Bank", banks[1]["Other"]},
+	}
+	if len(zr.File) != len(cases) {
+		t.Fatalf("Expected: %v entries, got: %v", len(cases), len(zr.File))
+	}
+	for i, c := range cases {
+		f := zr.File[i]
+		if f.Name != c.name {
+			t.Errorf("Expected: %v, got: %v", c.name, f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := &bytes.Buffer{}
+		if _, err := c.bank.WriteTo(exp); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, exp.Bytes()) {
+			t.Errorf("[%d] Expected: %s, got: %s", i, exp, got)
+		}
+	}
+}
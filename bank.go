@@ -4,9 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"math"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/beevik/etree"
@@ -18,30 +19,123 @@ import (
 // NewBanksFromReplay returns all banks of all players in a replay.
 // ret[iPlayer][strBankName] gives a pointer to a bank,
 // where player index starts from 0 excluding the neutral force.
+// If game events were decoded with errors, e.g. of a truncated replay, banks are recovered from
+// the events decoded up to the error and, unless the error came past the game loop 0 banks are loaded at,
+// a warning telling banks may be partial is logged.
 func NewBanksFromReplay(r *repm.Rep) (ret []map[string]*Bank) {
-	isBankEvent := func(gameEvent s2prot.Event) bool {
-		for _, bankEvt := range []string{
-			EvtTypeBankFile,
-			EvtTypeBankSection,
-			EvtTypeBankKey,
-			EvtTypeBankValue,
-			EvtTypeBankSignature,
-		} {
-			if gameEvent.EvtType.Name == bankEvt {
-				return true
+	ret, _ = NewBanksFromReplayE(r)
+	return ret
+}
+
+// Errors of bank events dropped while recovering banks, as Err of a RecoveryError.
+var (
+	ErrUnknownUser    = errors.New("bank event of unknown user")
+	ErrOrphanedEvents = errors.New("bank events of no bank")
+)
+
+// RecoveryError describes bank events dropped while recovering banks.
+type RecoveryError struct {
+	Err     error  // ErrUnknownUser or ErrOrphanedEvents
+	UserID  int64  // User ID of the events
+	Slot    int    // Index of the slot of the user, -1 if the user owns no slot
+	EvtType string // Event type name of the event dropped, of ErrUnknownUser
+	Count   int    // Number of events dropped
+}
+
+// Error implements error.
+func (e *RecoveryError) Error() string {
+	if e.Slot < 0 {
+		return fmt.Sprintf("%v: user %d: %s", e.Err, e.UserID, e.EvtType)
+	}
+	return fmt.Sprintf("%v: %d dropped of slot %d", e.Err, e.Count, e.Slot)
+}
+
+// Unwrap returns Err, for errors.Is.
+func (e *RecoveryError) Unwrap() error {
+	return e.Err
+}
+
+// NewBanksFromReplayE returns all banks of all players in a replay as NewBanksFromReplay does,
+// along with an error telling the bank events dropped, nil if none were.
+// The error joins a *RecoveryError for each event of a user owning no slot, and for each slot
+// having events preceding its first bank; they are logged as warnings all the same.
+func NewBanksFromReplayE(r *repm.Rep) ([]map[string]*Bank, error) {
+	var errs []error
+	ret := recoverBanks(r, 0, Log, nil, &errs)
+	return ret, errors.Join(errs...)
+}
+
+// RecoveryStats are counters of a bank recovery of a replay, for monitoring recovery health.
+type RecoveryStats struct {
+	BankEvents        int           // Bank events scanned
+	Banks             int           // Banks produced, over all players
+	OrphanedEvents    int           // Bank events dropped for preceding any bank of their slot
+	UnknownUserEvents int           // Bank events dropped for being of a user of no slot
+	Partial           bool          // Tells if game events were decoded with errors by the end of loop 0, e.g. of a truncated replay
+	Elapsed           time.Duration // Time taken to recover
+}
+
+// NewBanksFromReplayStats returns all banks of all players in a replay as NewBanksFromReplay does,
+// along with the counters of the recovery.
+func NewBanksFromReplayStats(r *repm.Rep) ([]map[string]*Bank, RecoveryStats) {
+	var stats RecoveryStats
+	start := time.Now()
+	ret := recoverBanks(r, 0, Log, &stats, nil)
+	stats.Elapsed = time.Since(start)
+	return ret, stats
+}
+
+// AllLoops is the loop limit of NewBanksFromReplayUntil scanning the events of all game loops.
+const AllLoops int64 = math.MaxInt64
+
+// NewBanksFromReplayUntil returns all banks of all players in a replay as NewBanksFromReplay does,
+// recovered from the bank events of the game loops up to 'maxLoop' inclusive rather than of the loop 0 only.
+// Some maps write banks mid-game, e.g. on save triggers; pass AllLoops to recover them as of the end of the replay.
+// The replay must have been decoded with all game events, NewFromFileBankEvts keeps those of the loop 0 only.
+//
+// A bank written again at a later loop than its last event overwrites the bank recovered so far,
+// so the bank returned reflects the final state as of 'maxLoop': the game rewrites the whole file on save,
+// merging the writes would keep keys the later write removed. LoadLoop tells the loop of the write kept.
+// A bank declared again within the same loop goes on as with NewBanksFromReplay.
+func NewBanksFromReplayUntil(r *repm.Rep, maxLoop int64) []map[string]*Bank {
+	return recoverBanks(r, maxLoop, Log, nil, nil)
+}
+
+// Banks returns an iterator over all banks of all players in a replay, yielding the index of the player
+// and the bank as NewBanksFromReplay gives them, ordered by player index, then by bank name.
+// Banks are recovered in one pass before the first yield; breaking early saves iterating the rest only.
+func Banks(r *repm.Rep) iter.Seq2[int, *Bank] {
+	return func(yield func(int, *Bank) bool) {
+		for iPlayer, playerBanks := range NewBanksFromReplay(r) {
+			for _, name := range sortedBankNames(playerBanks) {
+				if !yield(iPlayer, playerBanks[name]) {
+					return
+				}
 			}
 		}
-		return false
 	}
-	r.InitData.GameDescription.MaxObservers()
+}
 
+// recoverBanks returns the banks of all players in the replay 'r' as NewBanksFromReplayUntil does up to the loop 'maxLoop',
+// reporting anything suspicious met while recovering to 'warn'. Debug output goes to Log.
+// Counters are recorded to 'stats' unless it is nil, all but the elapsed time.
+// Errors of events dropped are appended to 'errs' unless it is nil.
+func recoverBanks(r *repm.Rep, maxLoop int64, warn Logger, stats *RecoveryStats, errs *[]error) []map[string]*Bank {
+	if stats == nil {
+		stats = &RecoveryStats{} // discarded
+	}
+	if errs == nil {
+		errs = new([]error) // discarded
+	}
 	// Player index starts from 0 excluding the neutral force. It ranges [0 ~ 9] when there are 10 players in a game.
 	// The number of players could be smaller than the actual number of lobby participants since there could be spectators.
-	// Slots include both players and spectators.
+	// Slots include both players and spectators, see LobbyLayout.
 	usersBank := make([]map[string]*Bank, len(r.InitData.LobbyState.Slots)) // banks
 	for iUser := range usersBank {
 		usersBank[iUser] = map[string]*Bank{}
 	}
+	// Single-player replays may leave the toon handle of the only human blank.
+	singlePlayer := r.IsSinglePlayer()
 	findPlayerByToonHandle := func() map[string]rep.Player {
 		ret := map[string]rep.Player{}
 		for _, player := range r.Details.Players() {
@@ -51,6 +145,19 @@ func NewBanksFromReplay(r *repm.Rep) (ret []map[string]*Bank) {
 		}
 		return ret
 	}()
+	findPlayerBySlot := func(slot rep.Slot) rep.Player {
+		if player, ok := findPlayerByToonHandle[slot.ToonHandle()]; ok {
+			return player
+		}
+		if singlePlayer && slot.Control() == rep.ControlHuman {
+			for _, player := range r.Details.Players() {
+				if player.Control() == rep.ControlHuman {
+					return player
+				}
+			}
+		}
+		return rep.Player{}
+	}
 	// Slots
 	type PlayerSlot struct {
 		rep.Slot
@@ -58,44 +165,185 @@ func NewBanksFromReplay(r *repm.Rep) (ret []map[string]*Bank) {
 	}
 	findSlotByUserID := func() map[int64]PlayerSlot {
 		ret := map[int64]PlayerSlot{}
-		for iSlot, slot := range r.InitData.LobbyState.Slots {
-			if slot.ToonHandle() != "" { // not to be overwritten
-				ret[slot.UserID()] = PlayerSlot{
-					Slot:  slot,
-					index: iSlot,
-				}
+		for userID, iSlot := range slotIndexByUserID(r) {
+			ret[userID] = PlayerSlot{
+				Slot:  r.InitData.LobbyState.Slots[iSlot],
+				index: iSlot,
 			}
 		}
 		return ret
 	}()
+	if !r.ProtocolExact {
+		warn.Printf("Warning: Banks recovered with a best-effort protocol of base build: %d", r.Header.BaseBuild())
+	}
+	if loop, ok := r.GameEvtsErrLoop(); ok && loop <= maxLoop {
+		// Events decoded up to the error are kept, banks of later events are missing or cut short
+		warn.Printf("Warning: Game events decoded with errors, banks may be partial")
+		stats.Partial = true
+	} else if ok {
+		Log.Printf("Debug: Game events decoded with errors past loop %d, at loop %d", maxLoop, loop)
+	}
 	// Collect banks events
-	var bankNameCurr string
+	// The current bank is tracked per slot, since bank events of different users may interleave.
+	// Content events a slot issues before its first "BankFile" event are held back
+	// until that event establishes the bank they belong to.
+	bankNameCurr := map[int]string{}       // slot index => name of the current bank
+	orphanEvts := map[int][]s2prot.Event{} // slot index => content events preceding any bank
 	for _, evt := range r.GameEvts {
-		if evt.Loop() > 0 {
+		if evt.Loop() > maxLoop {
 			break
 		}
 		if !isBankEvent(evt) {
 			continue
 		}
+		stats.BankEvents++
 		{ // slot
-			slot := findSlotByUserID[evt.UserID()] // get player slot
+			slot, ok := findSlotByUserID[evt.UserID()] // get player slot
+			if !ok {
+				// A zero slot would misattribute the event to the first slot
+				warn.Printf("Warning: Bank event of unknown user: %d %s", evt.UserID(), evt.EvtType.Name)
+				stats.UnknownUserEvents++
+				*errs = append(*errs, &RecoveryError{Err: ErrUnknownUser, UserID: evt.UserID(), Slot: -1, EvtType: evt.EvtType.Name, Count: 1})
+				continue
+			}
 			if evt.EvtType.Name == EvtTypeBankFile {
-				bankNameCurr = evt.Stringv("name")
-				usersBank[slot.index][bankNameCurr] = NewBank(r, evt, slot.Slot, findPlayerByToonHandle[slot.ToonHandle()])
-				// log.Println(slot.index, bankNameCurr) //
+				bankNameCurr[slot.index] = evt.Stringv("name")
+				// A bank declared again by the same slot goes on rather than being replaced,
+				// unless it is written again at a later loop, which rewrites it
+				bank := usersBank[slot.index][bankNameCurr[slot.index]]
+				if bank == nil || evt.Loop() > bank.LastWriteLoop() {
+					bank = NewBank(r, evt, slot.Slot, findPlayerBySlot(slot.Slot))
+				}
+				for _, orphanEvt := range orphanEvts[slot.index] {
+					bank.AddGameEvent(orphanEvt)
+				}
+				delete(orphanEvts, slot.index)
+				usersBank[slot.index][bankNameCurr[slot.index]] = bank
+				Log.Printf("Debug: Bank %q loaded by slot %d", bankNameCurr[slot.index], slot.index)
 				continue
 			}
-			if usersBank[slot.index][bankNameCurr] != nil {
-				// log.Println("Warning: Bank event of unknown bank file: ", evt) // probably map maker's fault //
-				usersBank[slot.index][bankNameCurr].AddGameEvent(evt)
+			if bank := usersBank[slot.index][bankNameCurr[slot.index]]; bank != nil {
+				bank.AddGameEvent(evt)
+			} else {
+				orphanEvts[slot.index] = append(orphanEvts[slot.index], evt)
 			}
 		}
 		continue
 	}
+	for iSlot := range usersBank {
+		if n := len(orphanEvts[iSlot]); n > 0 {
+			warn.Printf("Warning: %d bank events of no bank dropped of slot %d", n, iSlot)
+			stats.OrphanedEvents += n
+			userID := orphanEvts[iSlot][0].UserID()
+			*errs = append(*errs, &RecoveryError{Err: ErrOrphanedEvents, UserID: userID, Slot: iSlot, Count: n})
+		}
+		stats.Banks += len(usersBank[iSlot])
+	}
 
 	return usersBank
 }
 
+// slotIndexByUserID returns the indices of the lobby slots of the replay 'r' that may own banks, mapped from their user IDs.
+// Single-player replays may leave the toon handle of the only human blank, its slot is included nonetheless.
+// Anonymized replays leave the toon handles of all slots blank, human slots of user IDs no slot of a toon handle has
+// are included then, keyed on the user ID alone.
+func slotIndexByUserID(r *repm.Rep) map[int64]int {
+	singlePlayer := r.IsSinglePlayer()
+	ret := map[int64]int{}
+	for iSlot, slot := range r.InitData.LobbyState.Slots {
+		if slot.ToonHandle() != "" || singlePlayer && slot.Control() == rep.ControlHuman { // not to be overwritten
+			ret[slot.UserID()] = iSlot
+		}
+	}
+	for iSlot, slot := range r.InitData.LobbyState.Slots {
+		if _, ok := ret[slot.UserID()]; !ok && slot.ToonHandle() == "" && slot.Control() == rep.ControlHuman {
+			ret[slot.UserID()] = iSlot
+		}
+	}
+	return ret
+}
+
+// scanBankEvents calls 'fn' with every bank event of the replay 'r' across all game loops,
+// along with the index of the slot of its user and the name of the bank it belongs to.
+// The name is "" for content events a slot issues before its first "BankFile" event.
+// Events of users owning no slot are skipped.
+func scanBankEvents(r *repm.Rep, fn func(iSlot int, bankName string, evt s2prot.Event)) {
+	slots := slotIndexByUserID(r)
+	bankNameCurr := map[int]string{} // slot index => name of the current bank
+	for _, evt := range r.GameEvts {
+		if !isBankEvent(evt) {
+			continue
+		}
+		iSlot, ok := slots[evt.UserID()]
+		if !ok {
+			continue
+		}
+		if evt.EvtType.Name == EvtTypeBankFile {
+			bankNameCurr[iSlot] = evt.Stringv("name")
+		}
+		fn(iSlot, bankNameCurr[iSlot], evt)
+	}
+}
+
+// NewBanksByTeam returns all banks of all players in a replay grouped by team.
+// ret[team] gives the banks of all players of the team, where team is the 1-based team number of the owner slot;
+// banks of players without a team, whose slots have no team ID, are under team 0.
+// Banks of a team are ordered by player index, then by bank name.
+func NewBanksByTeam(r *repm.Rep) (ret map[int][]*Bank) {
+	ret = map[int][]*Bank{}
+	for _, playerBanks := range NewBanksFromReplay(r) {
+		for _, name := range sortedBankNames(playerBanks) {
+			bank := playerBanks[name]
+			team := 0
+			if bank.UserSlot.Value("teamId") != nil {
+				team = int(bank.UserSlot.TeamID()) + 1
+			}
+			ret[team] = append(ret[team], bank)
+		}
+	}
+	return ret
+}
+
+// NewBanksByToon returns all banks of all players in a replay mapped from the toon handles of their owner slots,
+// then from bank names. ret[toon][strBankName] gives a pointer to a bank.
+// Slots having no toon handle, e.g. of single-player or anonymized replays, are keyed "Player<user ID>" instead,
+// which never clashes with a toon handle; players without banks are left out.
+func NewBanksByToon(r *repm.Rep) (ret map[string]map[string]*Bank) {
+	ret = map[string]map[string]*Bank{}
+	for _, playerBanks := range NewBanksFromReplay(r) {
+		for name, bank := range playerBanks {
+			toon := toonKey(bank.UserSlot)
+			if ret[toon] == nil {
+				ret[toon] = map[string]*Bank{}
+			}
+			ret[toon][name] = bank
+		}
+	}
+	return ret
+}
+
+// toonKey returns the toon handle of the slot 'slot' players are keyed on in maps,
+// "Player<user ID>" if the slot has no toon handle, e.g. of single-player or anonymized replays.
+func toonKey(slot rep.Slot) string {
+	if toon := slot.ToonHandle(); toon != "" {
+		return toon
+	}
+	return fmt.Sprint("Player", slot.UserID())
+}
+
+// memoKeyBanks is the key banks are memoized on a rep under.
+type memoKeyBanks struct{}
+
+// CachedBanks returns the banks of the replay 'r' as NewBanksFromReplay does, computing them only once per rep.
+// It is safe for concurrent use, and all callers share the same result which they must not modify.
+// The cache assumes the events of the rep don't change after the first call;
+// use NewBanksFromReplay for fresh results.
+func CachedBanks(r *repm.Rep) []map[string]*Bank {
+	return repm.Memo(r, memoKeyBanks{}, func() interface{} {
+		return NewBanksFromReplay(r)
+	}).([]map[string]*Bank)
+}
+
 // NNet event protocol types regarding bank
 const (
 	EvtTypeBankFile      = "BankFile"
@@ -105,12 +353,33 @@ const (
 	EvtTypeBankSignature = "BankSignature"
 )
 
+// isBankEvent tells if 'gameEvent' is any of the bank events.
+func isBankEvent(gameEvent s2prot.Event) bool {
+	for _, bankEvt := range []string{
+		EvtTypeBankFile,
+		EvtTypeBankSection,
+		EvtTypeBankKey,
+		EvtTypeBankValue,
+		EvtTypeBankSignature,
+	} {
+		if gameEvent.EvtType.Name == bankEvt {
+			return true
+		}
+	}
+	return false
+}
+
+// Now is the time source of the timestamp written into banks, time.Now by default.
+// Override it to pin the timestamp, e.g. for golden tests.
+var Now = time.Now
+
 // Bank represents a bank of a player.
 type Bank struct {
 	r          *repm.Rep
 	Name       string     // filename
 	UserSlot   rep.Slot   // owner slot
 	Player     rep.Player // owner player
+	LoadLoop   int64      // loop of the "BankFile" event the bank was loaded at
 	GameEvents []s2prot.Event
 }
 
@@ -124,14 +393,82 @@ func NewBank(r *repm.Rep, evtBankFile s2prot.Event, user rep.Slot, player rep.Pl
 		Name:       evtBankFile.Stringv("name"),
 		UserSlot:   user,
 		Player:     player,
+		LoadLoop:   evtBankFile.Loop(),
 		GameEvents: []s2prot.Event{evtBankFile},
 	}
 }
 
+// PlayerName returns the name of the player owning this bank, or "Player<user ID>" if the owner player is not known,
+// e.g. of anonymized replays whose slots have no toon handles to find players by.
+func (bank *Bank) PlayerName() string {
+	if bank.Player.Name != "" {
+		return bank.Player.Name
+	}
+	return fmt.Sprint("Player", bank.UserSlot.UserID())
+}
+
+// AuthorToon returns the toon handle of the author of the map that wrote this bank, as the game description states it.
+// It may differ from the toon handle of the owner slot, which is of the player the bank is kept for:
+// the game keeps a bank under Banks/<author toon handle>/ of the account of the player,
+// and signs it with the author toon handle, see ComputeSignature.
+// It is empty if the replay doesn't state the author.
+func (bank *Bank) AuthorToon() string {
+	return bank.r.InitData.GameDescription.MapAuthorName()
+}
+
+// LoadTime returns the in-game time this bank was loaded at in the replay 'r'.
+func (bank *Bank) LoadTime(r *repm.Rep) time.Duration {
+	return r.LoopToDuration(bank.LoadLoop)
+}
+
+// LastWriteLoop returns the highest game loop among the events of this bank, that of its last write.
+// Banks recovered by NewBanksFromReplay hold events of loop 0 only, so it is 0 for them;
+// it tells the moment of the final save only for banks holding the events of later loops as well,
+// e.g. recovered by NewBanksFromReplayUntil.
+func (bank *Bank) LastWriteLoop() int64 {
+	var ret int64
+	for _, evt := range bank.GameEvents {
+		if loop := evt.Loop(); loop > ret {
+			ret = loop
+		}
+	}
+	return ret
+}
+
+// LastWriteTime returns the in-game time of the last write of this bank in the replay 'r', see LastWriteLoop.
+func (bank *Bank) LastWriteTime(r *repm.Rep) time.Duration {
+	return r.LoopToDuration(bank.LastWriteLoop())
+}
+
+// ProtocolExact tells if this bank was recovered with the protocol of the replay's base build.
+// If false, the replay is of a base build unknown to the decoder,
+// and the bank was recovered with the latest known protocol on a best-effort basis.
+func (bank *Bank) ProtocolExact() bool {
+	return bank.r.ProtocolExact
+}
+
 func (bank *Bank) String() string {
 	return fmt.Sprint(bank.GameEvents)
 }
 
+// SignatureBytes returns the raw signature of this bank from its "BankSignature" event,
+// the bytes WriteTo writes in hex. nil is returned if the bank has no signature event.
+func (bank *Bank) SignatureBytes() []byte {
+	var ret []byte
+	for _, evt := range bank.GameEvents {
+		if evt.EvtType.Name != EvtTypeBankSignature {
+			continue
+		}
+		sig := evt.Array("signature")
+		ret = make([]byte, len(sig))
+		for i, v := range sig {
+			n, _ := v.(int64)
+			ret[i] = byte(n)
+		}
+	}
+	return ret
+}
+
 // AddGameEvent accepts all bank events except for the "BankFile" event.
 func (bank *Bank) AddGameEvent(evtBankContent s2prot.Event) error {
 	switch evtBankContent.EvtType.Name {
@@ -150,77 +487,140 @@ func (bank *Bank) AddGameEvent(evtBankContent s2prot.Event) error {
 
 // WriteTo writes out this bank to the writer 'w'.
 // The function returns the number of bytes written and any error encountered.
+//
+// Sections, keys and values are emitted from the model Sections returns, followed by the signature.
+// Sections and keys written more than once are merged as the game keeps them, see Collisions.
+// Values of unknown types are dropped, as are the events the model leaves out; both are logged as warnings.
+//
+// Attributes are emitted in a fixed order: "name" always comes first on <Section> and <Key>,
+// and value elements carry a single attribute named after the value type.
+// The order is the one attributes are created in, which etree preserves.
 func (bank *Bank) WriteTo(w io.Writer) (n int64, err error) {
+	return bank.WriteToAs(w, bank.UserSlot.ToonHandle())
+}
+
+// WriteToAs writes out this bank to the writer 'w' as WriteTo does,
+// stating 'owner' as the player instead of the toon handle of the owner slot, unless it is empty.
+// This is meant to re-attribute banks of anonymized replays, whose toon handles are blank.
+func (bank *Bank) WriteToAs(w io.Writer, owner string) (n int64, err error) {
+	return bank.WriteToWithOptions(w, WriteOptions{Owner: owner})
+}
+
+// WriteOptions tunes how a bank is written out.
+type WriteOptions struct {
+	// Owner is the toon handle stated as the player, the toon handle of the owner slot if empty.
+	Owner string
+	// OmitEmptySections omits sections without keys, which some importers reject.
+	// The game keeps them, so they are written by default.
+	OmitEmptySections bool
+	// EmptySignature tells what to write for a "BankSignature" event of an empty signature.
+	EmptySignature EmptySignatureMode
+	// KeepDuplicates writes sections and keys written more than once as many times as they were written.
+	// By default they are merged as the game keeps them, a key holding the values of its last write, see Collisions.
+	KeepDuplicates bool
+	// OmitTimestamp omits the comment of the time the bank is written at, see Now,
+	// so recoveries of the same replay write identical bytes.
+	OmitTimestamp bool
+	// OmitComments omits all comments, those describing the replay and the timestamp alike.
+	OmitComments bool
+	// SignatureAuthor, if not empty, is the toon handle of the map author the signature is recomputed for
+	// with ComputeSignature, signed for Owner. The recomputed signature is written instead of the one replayed,
+	// also for banks having an empty signature or none, and EmptySignature is ignored.
+	SignatureAuthor string
+}
+
+// EmptySignatureMode tells how a bank having an empty signature is written out.
+type EmptySignatureMode int
+
+// Ways of writing an empty signature.
+const (
+	// EmptySignatureElement writes a <Signature/> element without a value, as the event holds. It is the default.
+	EmptySignatureElement EmptySignatureMode = iota
+	// EmptySignatureOmit writes no <Signature> element, as some maps expect of unsigned banks.
+	EmptySignatureOmit
+)
+
+// WriteToWithOptions writes out this bank to the writer 'w' as told by 'opts'.
+// The function returns the number of bytes written and any error encountered.
+func (bank *Bank) WriteToWithOptions(w io.Writer, opts WriteOptions) (n int64, err error) {
+	if opts.Owner == "" {
+		opts.Owner = bank.UserSlot.ToonHandle()
+	}
+	var signature string
+	if opts.SignatureAuthor != "" {
+		if signature, err = bank.computeSignature(opts.SignatureAuthor, opts.Owner); err != nil {
+			return 0, err
+		}
+	}
+
 	doc := etree.NewDocument()
 	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
 	root := doc.CreateElement("Bank")
 	root.CreateAttr("version", "1")
-	root.CreateComment(fmt.Sprint("Bank recovered from a replay"))
-	root.CreateComment(fmt.Sprint(time.Now()))
-	root.CreateComment(fmt.Sprint("Title: ", bank.r.Details.Title()))
-	root.CreateComment(fmt.Sprint("Version: ", bank.r.Header.VersionString()))
-	root.CreateComment(fmt.Sprint("Loops: ", bank.r.Header.Loops()))
-	root.CreateComment(fmt.Sprint("Length: ", bank.r.Header.Duration()))
-	root.CreateComment(fmt.Sprint("Player: ", bank.UserSlot.ToonHandle()))
-
-	var eCurrSection *etree.Element
-	var eCurrKey *etree.Element
-	for _, evt := range bank.GameEvents {
-		switch evt.EvtType.Name {
-		case EvtTypeBankSection:
-			eCurrSection = root.CreateElement("Section")
-			eCurrSection.CreateAttr("name", evt.Stringv("name"))
+	if !opts.OmitComments {
+		root.CreateComment(fmt.Sprint("Bank recovered from a replay"))
+		if !opts.OmitTimestamp {
+			root.CreateComment(fmt.Sprint(Now()))
+		}
+		root.CreateComment(fmt.Sprint("Title: ", bank.r.Details.Title()))
+		root.CreateComment(fmt.Sprint("Version: ", bank.r.Header.VersionString()))
+		root.CreateComment(fmt.Sprint("Loops: ", bank.r.Header.Loops()))
+		root.CreateComment(fmt.Sprint("Length: ", bank.r.Header.Duration()))
+		root.CreateComment(fmt.Sprint("Player: ", opts.Owner))
+		root.CreateComment(fmt.Sprint("Author: ", bank.AuthorToon()))
+		if !bank.r.ProtocolExact {
+			root.CreateComment(fmt.Sprint("Warning: decoded with a best-effort protocol, base build ", bank.r.Header.BaseBuild(), " is unknown"))
+		}
+	}
+
+	sections := bank.sections(ModelOptions{}, Log)
+	if !opts.KeepDuplicates {
+		sections = collapseSections(sections)
+	}
+	for _, section := range sections {
+		if opts.OmitEmptySections && len(section.Keys) == 0 {
 			continue
-		case EvtTypeBankKey:
-			eCurrKey = eCurrSection.CreateElement("Key")
-			eCurrKey.CreateAttr("name", evt.Stringv("name"))
-			if evt.Value("type") == nil {
-				continue
-			}
-			fallthrough // goto EvtTypeBankValue
-		case EvtTypeBankValue:
-			nType := evt.Int("type")
-			if nType == 7 { // value will be in the next message
-				continue
-			}
-			eVal := eCurrKey.CreateElement(func() string {
-				if name := evt.Stringv("name"); name != eCurrKey.Attr[0].Value {
-					return name
+		}
+		eSection := root.CreateElement("Section")
+		eSection.CreateAttr("name", section.Name)
+		for _, key := range section.Keys {
+			eKey := eSection.CreateElement("Key")
+			eKey.CreateAttr("name", key.Name)
+			for _, v := range key.Values {
+				if v.Type < BankValueTypeFixed || v.Type > BankValueTypeText {
+					continue // reported by sections
 				}
-				return "Value"
-			}())
-			eVal.CreateAttr([]string{
-				"fixed",
-				"flag",
-				"int",
-				"string",
-				"point", // "point",
-				"unit",  // "unit",
-				"text",
-			}[nType], evt.Stringv("data"))
-			continue
-		case EvtTypeBankSignature:
-			eCurrSection = root.CreateElement("Signature")
-			if len(evt.Array("signature")) > 0 {
-				eCurrSection.CreateAttr("value", func() string {
-					sb := &strings.Builder{}
-					for _, v := range evt.Array("signature") {
-						fmt.Fprintf(sb, "%02X", v)
-					}
-					return sb.String()
-				}())
+				eKey.CreateElement(v.Name).CreateAttr(v.Type.String(), v.Data)
 			}
-			continue
-		} // switch
-	} // for
+		}
+	}
+
+	switch sig := bank.SignatureBytes(); {
+	case signature != "":
+		root.CreateElement("Signature").CreateAttr("value", signature)
+	case len(sig) > 0:
+		root.CreateElement("Signature").CreateAttr("value", fmt.Sprintf("%X", sig))
+	case sig != nil && opts.EmptySignature != EmptySignatureOmit:
+		root.CreateElement("Signature")
+	}
 
 	doc.Indent(2)
 	return doc.WriteTo(w)
 } // func
 
+// ValidateOnSave tells SaveAsFile to validate banks before writing them, see Validate.
+// Banks found invalid are not written. It is off by default.
+var ValidateOnSave = false
+
 // SaveAsFile writes this bank out to the file at path 'strFilepath'.
 // Creates directories given as filepath if not present.
+// If ValidateOnSave is set, an error joining the problems Validate finds is returned instead of writing invalid banks.
 func (bank *Bank) SaveAsFile(strFilepath string) error {
+	if ValidateOnSave {
+		if errs := bank.Validate(); len(errs) > 0 {
+			return fmt.Errorf("invalid bank %q: %v", bank.Name, errors.Join(errs...))
+		}
+	}
 	if err := os.MkdirAll(filepath.Dir(strFilepath), os.ModePerm); err != nil {
 		return err
 	}
@@ -232,3 +632,24 @@ func (bank *Bank) SaveAsFile(strFilepath string) error {
 	_, err = bank.WriteTo(f)
 	return err
 }
+
+// SaveBanksFunc saves every bank in 'banks', as returned by NewBanksFromReplay, with SaveAsFile
+// at the path 'nameFn' returns for the bank and the index of its player.
+// Bank names are up to map authors, build paths of them with SanitizeBankFilename or ExpandPathTemplate.
+// Banks are saved in player index, then bank name order, stopping at the first error.
+// An empty path or one naming no file (e.g. "." or "dir/..") is reported as an error.
+func SaveBanksFunc(banks []map[string]*Bank, nameFn func(index int, bank *Bank) string) error {
+	for iPlayer, playerBanks := range banks {
+		for _, name := range sortedBankNames(playerBanks) {
+			bank := playerBanks[name]
+			p := nameFn(iPlayer, bank)
+			if base := filepath.Base(filepath.Clean(p)); p == "" || base == "." || base == ".." {
+				return fmt.Errorf("save bank %q of player %d: invalid path %q", name, iPlayer, p)
+			}
+			if err := bank.SaveAsFile(p); err != nil {
+				return fmt.Errorf("save bank %q of player %d: %v", name, iPlayer, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1530 @@
+package bankrecover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// Event types used by test fixtures.
+var (
+	testEvtTypeBankFile      = &s2prot.EvtType{Name: EvtTypeBankFile}
+	testEvtTypeBankSection   = &s2prot.EvtType{Name: EvtTypeBankSection}
+	testEvtTypeBankKey       = &s2prot.EvtType{Name: EvtTypeBankKey}
+	testEvtTypeBankValue     = &s2prot.EvtType{Name: EvtTypeBankValue}
+	testEvtTypeBankSignature = &s2prot.EvtType{Name: EvtTypeBankSignature}
+)
+
+// testEvt returns a bank event of type 'evtType' issued by user 'userID' at loop 'loop'.
+// 'fields' are name-value pairs of the event struct.
+func testEvt(evtType *s2prot.EvtType, userID, loop int64, fields ...interface{}) s2prot.Event {
+	s := s2prot.Struct{
+		"loop":   loop,
+		"userid": s2prot.Struct{"userId": userID},
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		s[fields[i].(string)] = fields[i+1]
+	}
+	return s2prot.Event{Struct: s, EvtType: evtType}
+}
+
+// testRep returns a replay of the lobby slots 'slots' and the players 'players' having the game events 'evts'.
+func testRep(slots, players []s2prot.Struct, evts ...s2prot.Event) *repm.Rep {
+	toArray := func(ss []s2prot.Struct) []interface{} {
+		ret := make([]interface{}, len(ss))
+		for i, s := range ss {
+			ret[i] = s
+		}
+		return ret
+	}
+	return &repm.Rep{
+		Details: rep.Details{Struct: s2prot.Struct{"playerList": toArray(players)}},
+		InitData: rep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+			"lobbyState": s2prot.Struct{"slots": toArray(slots)},
+		}}),
+		GameEvts:      evts,
+		ProtocolExact: true,
+	}
+}
+
+// testControlID returns the ID of the control 'control'.
+func testControlID(control *rep.Control) int64 {
+	for id, c := range rep.Controls {
+		if c == control {
+			return int64(id)
+		}
+	}
+	return -1
+}
+
+// testSlot returns a lobby slot of the user 'userID' having the toon handle 'toon' and the control 'control'.
+func testSlot(userID int64, toon string, control *rep.Control) s2prot.Struct {
+	return s2prot.Struct{"userId": userID, "toonHandle": toon, "control": testControlID(control)}
+}
+
+// testPlayer returns a player named 'name' having the toon id 'toonID' and the control 'control'.
+// The toon handle of the player is "1-S2-1-<toonID>", or left out if 'toonID' is 0.
+func testPlayer(name string, toonID int64, control *rep.Control) s2prot.Struct {
+	s := s2prot.Struct{"name": name, "control": testControlID(control)}
+	if toonID != 0 {
+		s["toon"] = s2prot.Struct{"region": int64(1), "programId": "S2", "realm": int64(1), "id": toonID}
+	}
+	return s
+}
+
+// testBank returns a bank named 'name' of user 0 made of the content events 'evts'.
+func testBank(name string, evts ...s2prot.Event) *Bank {
+	bank := &Bank{
+		r:          &repm.Rep{ProtocolExact: true},
+		Name:       name,
+		GameEvents: []s2prot.Event{testEvt(testEvtTypeBankFile, 0, 0, "name", name)},
+	}
+	for _, evt := range evts {
+		bank.AddGameEvent(evt)
+	}
+	return bank
+}
+
+// testBankFixture returns a small bank having two sections with inline and split values.
+func testBankFixture() *Bank {
+	return testBank("Fixture",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Stats"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Level", "type", int64(BankValueTypeInt), "data", "12"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Hero", "type", int64(BankValueTypeString), "data", "Raynor"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Items"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Sword", "type", int64(bankValueTypeNext), "data", ""),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "Sword", "type", int64(BankValueTypeFlag), "data", "1"),
+		testEvt(testEvtTypeBankSignature, 0, 0, "signature", []interface{}{int64(0xAB), int64(0x01)}),
+	)
+}
+
+func TestSections(t *testing.T) {
+	type value struct {
+		section, key, name string
+		typ                BankValueType
+		data               string
+	}
+	cases := []value{
+		{"Stats", "Level", "Value", BankValueTypeInt, "12"},
+		{"Stats", "Hero", "Value", BankValueTypeString, "Raynor"},
+		{"Items", "Sword", "Value", BankValueTypeFlag, "1"},
+	}
+
+	var got []value
+	for _, section := range testBankFixture().Sections() {
+		for _, key := range section.Keys {
+			for _, v := range key.Values {
+				got = append(got, value{section.Name, key.Name, v.Name, v.Type, v.Data})
+			}
+		}
+	}
+	if len(got) != len(cases) {
+		t.Fatalf("Expected: %v values, got: %v", len(cases), len(got))
+	}
+	for i, c := range cases {
+		if got[i] != c {
+			t.Errorf("Expected: %v, got: %v", c, got[i])
+		}
+	}
+}
+
+func TestTransformValues(t *testing.T) {
+	bank := testBankFixture()
+	transformed := bank.TransformValues(func(section, key string, typ BankValueType, value string) string {
+		if typ == BankValueTypeString {
+			return value + "!"
+		}
+		return value
+	})
+
+	if got := transformed.Sections()[0].Keys[1].Values[0].Data; got != "Raynor!" {
+		t.Errorf("Expected: %v, got: %v", "Raynor!", got)
+	}
+	if got := transformed.Sections()[0].Keys[0].Values[0].Data; got != "12" {
+		t.Errorf("Expected: %v, got: %v", "12", got)
+	}
+	if got := bank.Sections()[0].Keys[1].Values[0].Data; got != "Raynor" {
+		t.Errorf("Expected original to be unmodified: %v, got: %v", "Raynor", got)
+	}
+}
+
+func TestRangeKeys(t *testing.T) {
+	bank := testBank("Ranged",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Split", "type", int64(bankValueTypeNext), "data", ""),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "Split", "type", int64(BankValueTypeText), "data", "long"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Empty"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Odd", "type", int64(9), "data", "?"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "T"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Flag", "type", int64(BankValueTypeFlag), "data", "1"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "2"),
+	)
+
+	var got []string
+	bank.RangeKeys(func(section, key, valueType, data string) bool {
+		got = append(got, section+"/"+key+"/"+valueType+"/"+data)
+		return true
+	})
+	exp := []string{"S/K/int/2", "S/Split/text/long", "T/Flag/flag/1"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+
+	n := 0
+	bank.RangeKeys(func(section, key, valueType, data string) bool {
+		n++
+		return key != "Split"
+	})
+	if n != 2 {
+		t.Errorf("Expected: %v, got: %v", 2, n)
+	}
+}
+
+func TestFlattenPlayerBanks(t *testing.T) {
+	playerBanks := map[string]*Bank{
+		"Zeta": testBank("Zeta",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		),
+		"Alpha": testBankFixture(),
+	}
+	cases := []FlatKey{
+		{"Alpha", "Stats", "Level", BankValueTypeInt, "12"},
+		{"Alpha", "Stats", "Hero", BankValueTypeString, "Raynor"},
+		{"Alpha", "Items", "Sword", BankValueTypeFlag, "1"},
+		{"Zeta", "S", "K", BankValueTypeInt, "1"},
+	}
+
+	got := FlattenPlayerBanks(playerBanks)
+	if len(got) != len(cases) {
+		t.Fatalf("Expected: %v keys, got: %v", len(cases), len(got))
+	}
+	for i, c := range cases {
+		if got[i] != c {
+			t.Errorf("Expected: %v, got: %v", c, got[i])
+		}
+	}
+}
+
+func TestNewBanksFromReplaySinglePlayer(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(1, "", rep.ControlComputer),
+			testSlot(0, "", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("Computer", 0, rep.ControlComputer),
+			testPlayer("Me", 0, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Campaign"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+	)
+
+	banks := NewBanksFromReplay(r)
+	if len(banks[0]) != 0 {
+		t.Errorf("Expected: %v banks of the computer, got: %v", 0, len(banks[0]))
+	}
+	bank := banks[1]["Campaign"]
+	if bank == nil {
+		t.Fatalf("Expected the bank of the human to be recovered")
+	}
+	if bank.Player.Name != "Me" {
+		t.Errorf("Expected: %v, got: %v", "Me", bank.Player.Name)
+	}
+	if got := len(bank.GameEvents); got != 2 {
+		t.Errorf("Expected: %v events, got: %v", 2, got)
+	}
+}
+
+func TestWriteToAttributeOrder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if _, err := testBankFixture().WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	cases := []string{
+		`<Bank version="1">`,
+		`<Section name="Stats">`,
+		`<Key name="Level">`,
+		`<Value int="12"/>`,
+		`<Key name="Hero">`,
+		`<Value string="Raynor"/>`,
+		`<Section name="Items">`,
+		`<Key name="Sword">`,
+		`<Value flag="1"/>`,
+		`<Signature value="AB01"/>`,
+	}
+
+	out := buf.String()
+	for _, c := range cases {
+		if !strings.Contains(out, c) {
+			t.Errorf("Expected: %v, got: %v", c, out)
+		}
+	}
+}
+
+func TestNewBanksFromReplayInterleaved(t *testing.T) {
+	// User 1 issues a section before its own bank file while the bank of user 0 is the latest one.
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("B", 2, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "BankA"),
+		testEvt(testEvtTypeBankSection, 1, 0, "name", "SectionB"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "BankB"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "SectionA"),
+		testEvt(testEvtTypeBankKey, 1, 0, "name", "KeyB", "type", int64(BankValueTypeInt), "data", "2"),
+	)
+
+	banks := NewBanksFromReplay(r)
+	cases := []struct {
+		iPlayer  int
+		bankName string
+		sections []string
+	}{
+		{0, "BankA", []string{"SectionA"}},
+		{1, "BankB", []string{"SectionB"}},
+	}
+	for _, c := range cases {
+		bank := banks[c.iPlayer][c.bankName]
+		if bank == nil {
+			t.Errorf("Expected bank %v of player %v to be recovered", c.bankName, c.iPlayer)
+			continue
+		}
+		var got []string
+		for _, section := range bank.Sections() {
+			got = append(got, section.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(c.sections, ",") {
+			t.Errorf("Expected: %v, got: %v", c.sections, got)
+		}
+	}
+	if got := len(banks[1]["BankB"].Sections()[0].Keys); got != 1 {
+		t.Errorf("Expected: %v keys, got: %v", 1, got)
+	}
+}
+
+func TestNewBanksFromReplayStrayUser(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("B", 2, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankFile, 7, 0, "name", "Stray"),
+		testEvt(testEvtTypeBankSection, 7, 0, "name", "Stray"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Section"),
+	)
+
+	defer func(l Logger) { Log = l }(Log)
+	var logged []string
+	Log = LoggerFunc(func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	})
+
+	banks := NewBanksFromReplay(r)
+	if len(banks) != 2 {
+		t.Fatalf("Expected: %v players, got: %v", 2, len(banks))
+	}
+	if exp := "Warning: Bank event of unknown user: 7 BankFile"; !strings.Contains(strings.Join(logged, "\n"), exp) {
+		t.Errorf("Expected %q to be logged, got: %v", exp, logged)
+	}
+	if banks[0]["Stray"] != nil {
+		t.Errorf("Expected the bank of an unknown user not to be attributed to slot 0")
+	}
+	if got := len(banks[0]["Bank"].Sections()); got != 1 {
+		t.Errorf("Expected: %v sections, got: %v", 1, got)
+	}
+}
+
+func TestNewBanksFromReplayStats(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("B", 2, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankSection, 1, 0, "name", "Orphan"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Other"),
+		testEvt(testEvtTypeBankFile, 7, 0, "name", "Stray"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Section"),
+		testEvt(testEvtTypeBankSection, 0, 1, "name", "Late"),
+	)
+
+	banks, stats := NewBanksFromReplayStats(r)
+	if len(banks) != 2 {
+		t.Fatalf("Expected: %v players, got: %v", 2, len(banks))
+	}
+	exp := RecoveryStats{BankEvents: 5, Banks: 2, OrphanedEvents: 1, UnknownUserEvents: 1}
+	if stats.Elapsed < 0 {
+		t.Errorf("Expected a non-negative elapsed time, got: %v", stats.Elapsed)
+	}
+	stats.Elapsed = 0
+	if stats != exp {
+		t.Errorf("Expected: %+v, got: %+v", exp, stats)
+	}
+}
+
+func TestNewBanksFromReplayE(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("B", 2, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankSection, 1, 0, "name", "Orphan"),
+		testEvt(testEvtTypeBankKey, 1, 0, "name", "Orphan", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankFile, 7, 0, "name", "Stray"),
+	)
+
+	banks, err := NewBanksFromReplayE(r)
+	if len(banks) != 2 || banks[0]["Bank"] == nil {
+		t.Fatalf("Expected bank %q of player 0, got: %v", "Bank", banks)
+	}
+	if !errors.Is(err, ErrUnknownUser) || !errors.Is(err, ErrOrphanedEvents) {
+		t.Fatalf("Expected errors of unknown user and orphaned events, got: %v", err)
+	}
+	var got []RecoveryError
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		got = append(got, *e.(*RecoveryError))
+	}
+	exp := []RecoveryError{
+		{Err: ErrUnknownUser, UserID: 7, Slot: -1, EvtType: EvtTypeBankFile, Count: 1},
+		{Err: ErrOrphanedEvents, UserID: 1, Slot: 1, Count: 2},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %+v, got: %+v", exp, got)
+	}
+
+	r = testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+	)
+	if _, err := NewBanksFromReplayE(r); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestNewBanksFromReplayAnonymized(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "", rep.ControlHuman),
+			testSlot(1, "", rep.ControlHuman),
+			testSlot(2, "", rep.ControlComputer),
+		},
+		[]s2prot.Struct{
+			testPlayer("", 0, rep.ControlHuman),
+			testPlayer("", 0, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "A"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "B"),
+		testEvt(testEvtTypeBankKey, 1, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankFile, 2, 0, "name", "C"),
+	)
+
+	banks, err := NewBanksFromReplayE(r)
+	if !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("Expected error of the computer's event, got: %v", err)
+	}
+	cases := []struct {
+		iPlayer          int
+		name, playerName string
+	}{
+		{0, "A", "Player0"},
+		{1, "B", "Player1"},
+	}
+	for _, c := range cases {
+		bank := banks[c.iPlayer][c.name]
+		if bank == nil {
+			t.Errorf("Expected bank %q of player %d", c.name, c.iPlayer)
+			continue
+		}
+		if got := bank.PlayerName(); got != c.playerName {
+			t.Errorf("Expected: %v, got: %v", c.playerName, got)
+		}
+		if _, err := bank.WriteTo(&bytes.Buffer{}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if len(banks[2]) != 0 {
+		t.Errorf("Expected no banks of the computer, got: %v", banks[2])
+	}
+}
+
+func TestNewBanksByToon(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "", rep.ControlHuman),
+			testSlot(2, "1-S2-1-3", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("", 0, rep.ControlHuman),
+			testPlayer("C", 3, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "A1"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "A2"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "B"),
+	)
+
+	got := map[string][]string{}
+	for toon, banks := range NewBanksByToon(r) {
+		got[toon] = sortedBankNames(banks)
+		for name, bank := range banks {
+			if bank.Name != name {
+				t.Errorf("Expected: %v, got: %v", name, bank.Name)
+			}
+		}
+	}
+	exp := map[string][]string{"1-S2-1-1": {"A1", "A2"}, "Player1": {"B"}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestNewBanksFromReplayPartial(t *testing.T) {
+	// Game events of a replay truncated in the middle of a bank, decoded up to the cut
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+	)
+	r.GameEvtsErr = true
+
+	defer func(l Logger) { Log = l }(Log)
+	var logged []string
+	Log = LoggerFunc(func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	})
+
+	banks, stats := NewBanksFromReplayStats(r)
+	if v, ok := banks[0]["Bank"].Lookup("S", "K"); !ok || v.Data != "1" {
+		t.Errorf("Expected the decoded key to be recovered, got: %v, %v", v, ok)
+	}
+	if !stats.Partial {
+		t.Errorf("Expected the recovery to be partial")
+	}
+	exp := "Warning: Game events decoded with errors, banks may be partial"
+	if !strings.Contains(strings.Join(logged, "\n"), exp) {
+		t.Errorf("Expected %q to be logged, got: %v", exp, logged)
+	}
+
+	_, report, err := RecoverAndValidate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(report.Warnings) != fmt.Sprint([]string{exp}) {
+		t.Errorf("Expected: %v, got: %v", []string{exp}, report.Warnings)
+	}
+
+	// Cut past loop 0, bank events are complete
+	r.GameEvts = append(r.GameEvts, testEvt(testEvtTypeBankKey, 0, 16, "name", "L"))
+	if _, stats := NewBanksFromReplayStats(r); stats.Partial {
+		t.Errorf("Expected the recovery not to be partial")
+	}
+}
+
+func TestWriteToValueTypes(t *testing.T) {
+	bank := testBank("Types",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Fixed", "type", int64(BankValueTypeFixed), "data", "1.5000"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Point", "type", int64(BankValueTypePoint), "data", "12.5,30"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Unit", "type", int64(BankValueTypeUnit), "data", "Marine"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Text", "type", int64(BankValueTypeText), "data", "a <b> & \"c\""),
+	)
+	buf := &bytes.Buffer{}
+	if _, err := bank.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{
+		`<Key name="Fixed">
+      <Value fixed="1.5000"/>`,
+		`<Key name="Point">
+      <Value point="12.5,30"/>`,
+		`<Key name="Unit">
+      <Value unit="Marine"/>`,
+		`<Key name="Text">
+      <Value text="a &lt;b&gt; &amp; &quot;c&quot;"/>`,
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("Expected: %v, got: %v", exp, buf.String())
+		}
+	}
+}
+
+func TestWriteToNow(t *testing.T) {
+	defer func(now func() time.Time) { Now = now }(Now)
+	pinned := time.Date(2022, 1, 12, 0, 0, 0, 0, time.UTC)
+	Now = func() time.Time { return pinned }
+
+	var outs []string
+	for i := 0; i < 2; i++ {
+		buf := &bytes.Buffer{}
+		if _, err := testBankFixture().WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		outs = append(outs, buf.String())
+	}
+	if outs[0] != outs[1] {
+		t.Errorf("Expected identical outputs, got: %v and %v", outs[0], outs[1])
+	}
+	if c := fmt.Sprint("<!--", pinned, "-->"); !strings.Contains(outs[0], c) {
+		t.Errorf("Expected: %v, got: %v", c, outs[0])
+	}
+}
+
+func TestWriteToWithOptionsComments(t *testing.T) {
+	defer func(now func() time.Time) { Now = now }(Now)
+	cases := []struct {
+		opts          WriteOptions
+		comments      int
+		deterministic bool
+	}{
+		{WriteOptions{}, 8, false},
+		{WriteOptions{OmitTimestamp: true}, 7, true},
+		{WriteOptions{OmitComments: true}, 0, true},
+	}
+	for i, c := range cases {
+		var outs []string
+		for j := 0; j < 2; j++ {
+			Now = func() time.Time { return time.Unix(int64(j), 0) }
+			bank := testBankFixture()
+			bank.UserSlot = rep.Slot{Struct: s2prot.Struct{"toonHandle": "1-S2-1-2"}}
+			buf := &bytes.Buffer{}
+			if _, err := bank.WriteToWithOptions(buf, c.opts); err != nil {
+				t.Fatal(err)
+			}
+			outs = append(outs, buf.String())
+		}
+		if got := strings.Count(outs[0], "<!--"); got != c.comments {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.comments, got)
+		}
+		if got := strings.Contains(outs[0], "<!--Player: 1-S2-1-2-->"); got != (c.comments > 0) {
+			t.Errorf("[%d] Expected Player comment: %v, got: %v", i, c.comments > 0, got)
+		}
+		if got := outs[0] == outs[1]; got != c.deterministic {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.deterministic, got)
+		}
+		if !strings.Contains(outs[0], `<Value string="Raynor"/>`) {
+			t.Errorf("[%d] Expected keys, got: %v", i, outs[0])
+		}
+	}
+}
+
+func TestWriteToAuthor(t *testing.T) {
+	bank := testBankFixture()
+	bank.UserSlot = rep.Slot{Struct: s2prot.Struct{"toonHandle": "1-S2-1-2"}}
+	bank.r.InitData = rep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+		"gameDescription": s2prot.Struct{"mapAuthorName": "1-S2-1-9"},
+	}})
+	if got := bank.AuthorToon(); got != "1-S2-1-9" {
+		t.Errorf("Expected: %v, got: %v", "1-S2-1-9", got)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := bank.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"<!--Player: 1-S2-1-2-->", "<!--Author: 1-S2-1-9-->"} {
+		if got := buf.String(); !strings.Contains(got, c) {
+			t.Errorf("Expected: %v, got: %v", c, got)
+		}
+	}
+}
+
+func TestSectionsValueFields(t *testing.T) {
+	bank := testBank("Bank",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Inline", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Split", "type", int64(bankValueTypeNext), "data", ""),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "Split", "type", int64(BankValueTypeString), "data", "a"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Empty"),
+	)
+	exp := []Section{{Name: "S", Keys: []Key{
+		{Name: "Inline", Values: []Value{{Name: "Value", Type: BankValueTypeInt, Data: "1"}}},
+		{Name: "Split", Values: []Value{{Name: "Value", Type: BankValueTypeString, Data: "a"}}},
+		{Name: "Empty"},
+	}}}
+	got := bank.Sections()
+	for i := range got {
+		for j := range got[i].Keys {
+			for k := range got[i].Keys[j].Values {
+				got[i].Keys[j].Values[k].evt = 0
+			}
+		}
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+
+	transformed := bank.TransformValues(func(section, key string, typ BankValueType, value string) string { return "0" })
+	if v, _ := transformed.Lookup("S", "Split"); v.Data != "0" {
+		t.Errorf("Expected: %v, got: %v", "0", v.Data)
+	}
+}
+
+func TestSubset(t *testing.T) {
+	bank := testBankFixture()
+	n := len(bank.GameEvents)
+	sub := bank.Subset([]SectionKey{{"Items", "Sword"}, {"Stats", "Level"}, {"Stats", "Missing"}, {"Items", "Level"}})
+
+	var got []string
+	for _, section := range sub.Sections() {
+		for _, key := range section.Keys {
+			for _, v := range key.Values {
+				got = append(got, fmt.Sprint(section.Name, ".", key.Name, "=", v.Type, ":", v.Data))
+			}
+		}
+	}
+	if exp := []string{"Stats.Level=int:12", "Items.Sword=flag:1"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if sig := sub.SignatureBytes(); sig != nil {
+		t.Errorf("Expected no signature, got: %v", sig)
+	}
+	if sub.Name != bank.Name || sub.GameEvents[0].EvtType.Name != EvtTypeBankFile {
+		t.Errorf("Expected the subset to keep the bank file event of %q", bank.Name)
+	}
+	if len(bank.GameEvents) != n {
+		t.Errorf("Expected the original bank to be left unmodified")
+	}
+	if got := len(bank.Subset(nil).Sections()); got != 0 {
+		t.Errorf("Expected: %v sections, got: %v", 0, got)
+	}
+}
+
+func TestLastWriteLoop(t *testing.T) {
+	if got := testBankFixture().LastWriteLoop(); got != 0 {
+		t.Errorf("Expected: %v, got: %v", 0, got)
+	}
+	bank := testBank("Saved",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 320, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankKey, 0, 160, "name", "K", "type", int64(BankValueTypeInt), "data", "2"),
+	)
+	if got := bank.LastWriteLoop(); got != 320 {
+		t.Errorf("Expected: %v, got: %v", 320, got)
+	}
+	if got := bank.LastWriteTime(&repm.Rep{}); got != 20*time.Second {
+		t.Errorf("Expected: %v, got: %v", 20*time.Second, got)
+	}
+}
+
+func TestSectionsWithOptionsTrimSpace(t *testing.T) {
+	bank := testBank("Padded",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "String", "type", int64(BankValueTypeString), "data", "  padded \t"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Text", "type", int64(BankValueTypeText), "data", " text "),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Int", "type", int64(BankValueTypeInt), "data", " 1 "),
+	)
+	cases := []struct {
+		opts ModelOptions
+		data []string
+	}{
+		{ModelOptions{}, []string{"  padded \t", " text ", " 1 "}},
+		{ModelOptions{TrimSpace: true}, []string{"padded", "text", " 1 "}},
+	}
+
+	for _, c := range cases {
+		keys := bank.SectionsWithOptions(c.opts)[0].Keys
+		for i, data := range c.data {
+			if got := keys[i].Values[0].Data; got != data {
+				t.Errorf("Expected: %q, got: %q", data, got)
+			}
+		}
+	}
+}
+
+func TestWriteToWithOptionsOmitEmptySections(t *testing.T) {
+	bank := testBank("Empty",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Full"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Trailing"),
+	)
+	if got := bank.EmptySections(); len(got) != 1 || got[0] != "Trailing" {
+		t.Errorf("Expected: %v, got: %v", []string{"Trailing"}, got)
+	}
+
+	cases := []struct {
+		opts     WriteOptions
+		trailing bool
+	}{
+		{WriteOptions{}, true},
+		{WriteOptions{OmitEmptySections: true}, false},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		if _, err := bank.WriteToWithOptions(buf, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), `<Section name="Full">`) {
+			t.Errorf("Expected section %v to be written", "Full")
+		}
+		if got := strings.Contains(buf.String(), `<Section name="Trailing"`); got != c.trailing {
+			t.Errorf("Expected: %v, got: %v", c.trailing, got)
+		}
+	}
+}
+
+func TestWriteToWithOptionsEmptySignature(t *testing.T) {
+	unsigned := testBank("Unsigned",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankSignature, 0, 0, "signature", []interface{}{}),
+	)
+	cases := []struct {
+		bank *Bank
+		opts WriteOptions
+		exp  string // signature element expected, empty if none
+	}{
+		{unsigned, WriteOptions{}, "<Signature/>"},
+		{unsigned, WriteOptions{EmptySignature: EmptySignatureElement}, "<Signature/>"},
+		{unsigned, WriteOptions{EmptySignature: EmptySignatureOmit}, ""},
+		{testBankFixture(), WriteOptions{EmptySignature: EmptySignatureOmit}, `<Signature value="AB01"/>`},
+	}
+	for i, c := range cases {
+		buf := &bytes.Buffer{}
+		if _, err := c.bank.WriteToWithOptions(buf, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		if c.exp == "" {
+			if strings.Contains(buf.String(), "<Signature") {
+				t.Errorf("[%d] Expected no signature element, got: %v", i, buf.String())
+			}
+		} else if !strings.Contains(buf.String(), c.exp) {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.exp, buf.String())
+		}
+	}
+}
+
+func TestKeyCountTotalKeys(t *testing.T) {
+	repeated := testBank("Repeated",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "2"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "T"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "3"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "L", "type", int64(BankValueTypeInt), "data", "4"),
+	)
+	cases := []struct {
+		bank *Bank
+		exp  int
+	}{
+		{testBank("Empty"), 0},
+		{testBankFixture(), 3},
+		{repeated, 3},
+	}
+	for i, c := range cases {
+		if got := c.bank.KeyCount(); got != c.exp {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.exp, got)
+		}
+	}
+
+	banks := []map[string]*Bank{{"Fixture": testBankFixture(), "Repeated": repeated}, {}, {"Empty": testBank("Empty")}}
+	if got := TotalKeys(banks); got != 6 {
+		t.Errorf("Expected: %v, got: %v", 6, got)
+	}
+	if got := TotalKeys(nil); got != 0 {
+		t.Errorf("Expected: %v, got: %v", 0, got)
+	}
+}
+
+func TestTypeHistogram(t *testing.T) {
+	bank := testBank("Types",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "A", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "B", "type", int64(BankValueTypeInt), "data", "2"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "C", "type", int64(BankValueTypeString), "data", "c"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "C", "type", int64(BankValueTypeUnit), "data", "u"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "D", "type", int64(9), "data", "?"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "E", "type", int64(bankValueTypeNext), "data", ""),
+	)
+	exp := map[BankValueType]int{BankValueTypeInt: 2, BankValueTypeUnit: 1, BankValueTypeUnknown: 1}
+	if got := bank.TypeHistogram(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if got := testBank("Empty").TypeHistogram(); len(got) != 0 {
+		t.Errorf("Expected: %v, got: %v", map[BankValueType]int{}, got)
+	}
+}
+
+func TestWriteToStrayEvents(t *testing.T) {
+	bank := testBank("Stray",
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "Lead", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Orphan", "type", int64(BankValueTypeInt), "data", "2"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "Early", "type", int64(BankValueTypeInt), "data", "3"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "4"),
+	)
+
+	defer func(l Logger) { Log = l }(Log)
+	var logged []string
+	Log = LoggerFunc(func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	})
+
+	buf := &bytes.Buffer{}
+	if _, err := bank.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, dropped := range []string{"Lead", "Orphan", "Early"} {
+		if strings.Contains(buf.String(), dropped) {
+			t.Errorf("Expected %q to be dropped, got: %v", dropped, buf.String())
+		}
+	}
+	if exp := `<Key name="K">`; !strings.Contains(buf.String(), exp) {
+		t.Errorf("Expected: %v, got: %v", exp, buf.String())
+	}
+	exp := []string{
+		`Warning: Value "Lead" of no key dropped of bank "Stray"`,
+		`Warning: Key "Orphan" of no section dropped of bank "Stray"`,
+		`Warning: Value "Early" of no key dropped of bank "Stray"`,
+	}
+	if !reflect.DeepEqual(logged, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, logged)
+	}
+
+	sections := bank.Sections()
+	if len(sections) != 1 || len(sections[0].Keys) != 1 || sections[0].Keys[0].Name != "K" {
+		t.Errorf("Expected only key %q to be modeled, got: %v", "K", sections)
+	}
+}
+
+func TestWriteToSplitValues(t *testing.T) {
+	bank := testBank("Split",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Split", "type", int64(bankValueTypeNext), "data", ""),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "Split", "type", int64(BankValueTypeText), "data", "long text"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Cut", "type", int64(bankValueTypeNext), "data", ""),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Odd", "type", int64(9), "data", "?"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Last", "type", int64(bankValueTypeNext), "data", ""),
+	)
+
+	defer func(l Logger) { Log = l }(Log)
+	var logged []string
+	Log = LoggerFunc(func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	})
+
+	buf := &bytes.Buffer{}
+	if _, err := bank.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if exp := `<Key name="Split">
+      <Value text="long text"/>
+    </Key>`; !strings.Contains(buf.String(), exp) {
+		t.Errorf("Expected: %v, got: %v", exp, buf.String())
+	}
+	exp := []string{
+		`Warning: Value of key "Cut" missing of bank "Split"`,
+		`Warning: Value of unknown type 9 dropped of key "Odd" of bank "Split"`,
+		`Warning: Value of key "Last" missing of bank "Split"`,
+	}
+	if !reflect.DeepEqual(logged, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, logged)
+	}
+	if v, ok := bank.Lookup("S", "Split"); !ok || v.Type != BankValueTypeText || v.Data != "long text" {
+		t.Errorf("Expected the split value to be modeled, got: %v, %v", v, ok)
+	}
+}
+
+func TestCollectKeyValuesAnyPlayerHasKey(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+			testSlot(2, "1-S2-1-3", rep.ControlHuman),
+		},
+		nil,
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Rank"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Rank", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Rank", "type", int64(BankValueTypeInt), "data", "3"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Rank"),
+		testEvt(testEvtTypeBankSection, 1, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 1, 0, "name", "Rank", "type", int64(BankValueTypeInt), "data", "2"),
+		testEvt(testEvtTypeBankFile, 2, 0, "name", "Rank"),
+		testEvt(testEvtTypeBankSection, 2, 0, "name", "S"),
+	)
+
+	banks := NewBanksFromReplay(r)
+	got := CollectKeyValues(banks, "Rank", "S", "Rank")
+	cases := map[string]string{"1-S2-1-1": "3", "1-S2-1-2": "2"}
+	if len(got) != len(cases) {
+		t.Errorf("Expected: %v, got: %v", cases, got)
+	}
+	for toon, value := range cases {
+		if got[toon] != value {
+			t.Errorf("Expected: %v, got: %v", value, got[toon])
+		}
+	}
+	if progress := ProgressValues(r, "Rank", "S", "Rank"); fmt.Sprint(progress) != fmt.Sprint(got) {
+		t.Errorf("Expected: %v, got: %v", got, progress)
+	}
+
+	if toons, exp := AnyPlayerHasKey(banks, "Rank", "S", "Rank"), []string{"1-S2-1-1", "1-S2-1-2"}; fmt.Sprint(toons) != fmt.Sprint(exp) {
+		t.Errorf("Expected: %v, got: %v", exp, toons)
+	}
+	if toons := AnyPlayerHasKey(banks, "Rank", "S", "Cheat"); toons != nil {
+		t.Errorf("Expected: %v, got: %v", nil, toons)
+	}
+}
+
+func TestSaveBanksFunc(t *testing.T) {
+	dir := t.TempDir()
+	banks := []map[string]*Bank{
+		{"B": testBank("B"), "A": testBank("A")},
+		{"A": testBank("A")},
+	}
+
+	var got []string
+	err := SaveBanksFunc(banks, func(index int, bank *Bank) string {
+		got = append(got, fmt.Sprint(index, bank.Name))
+		return filepath.Join(dir, fmt.Sprint(index), bank.Name+".SC2Bank")
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if exp := []string{"0A", "0B", "1A"}; fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1", "A.SC2Bank")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	for _, p := range []string{"", ".", filepath.Join(dir, "..")} {
+		if err := SaveBanksFunc(banks, func(int, *Bank) string { return p }); err == nil {
+			t.Errorf("Expected error for path %q", p)
+		}
+	}
+}
+
+func TestSignatureBytes(t *testing.T) {
+	if got := testBankFixture().SignatureBytes(); !bytes.Equal(got, []byte{0xAB, 0x01}) {
+		t.Errorf("Expected: %X, got: %X", []byte{0xAB, 0x01}, got)
+	}
+	if got := testBank("Unsigned").SignatureBytes(); got != nil {
+		t.Errorf("Expected: %v, got: %v", nil, got)
+	}
+}
+
+func TestNewBanksFromReplayRedeclared(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "First"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Second"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "2"),
+	)
+
+	bank := NewBanksFromReplay(r)[0]["Bank"]
+	var got []string
+	for _, section := range bank.Sections() {
+		got = append(got, section.Name)
+	}
+	if exp := []string{"First", "Second"}; fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestNewBanksFromReplayUntil(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Loaded"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankFile, 0, 100, "name", "Bank"),
+		testEvt(testEvtTypeBankSection, 0, 100, "name", "Saved"),
+		testEvt(testEvtTypeBankKey, 0, 100, "name", "K", "type", int64(BankValueTypeInt), "data", "2"),
+		testEvt(testEvtTypeBankFile, 0, 200, "name", "Other"),
+	)
+
+	cases := []struct {
+		maxLoop  int64
+		sections []string // sections of "Bank"
+		loadLoop int64
+		banks    int
+	}{
+		{0, []string{"Loaded"}, 0, 1},
+		{150, []string{"Saved"}, 100, 1},
+		{AllLoops, []string{"Saved"}, 100, 2},
+	}
+	for i, c := range cases {
+		banks := NewBanksFromReplayUntil(r, c.maxLoop)[0]
+		bank := banks["Bank"]
+		var got []string
+		for _, section := range bank.Sections() {
+			got = append(got, section.Name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.sections) {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.sections, got)
+		}
+		if bank.LoadLoop != c.loadLoop {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.loadLoop, bank.LoadLoop)
+		}
+		if len(banks) != c.banks {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.banks, len(banks))
+		}
+	}
+}
+
+func TestModifiedBanks(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		nil,
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Loaded"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Loaded"),
+		testEvt(testEvtTypeBankFile, 0, 320, "name", "Saved"),
+		testEvt(testEvtTypeBankSection, 0, 320, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 320, "name", "K", "type", int64(BankValueTypeInt), "data", "2"),
+		testEvt(testEvtTypeBankFile, 1, 480, "name", "Loaded"),
+		testEvt(testEvtTypeBankSection, 1, 480, "name", "S"),
+	)
+
+	got := ModifiedBanks(r)
+	if len(got) != 1 || fmt.Sprint(got["1-S2-1-1"]) != fmt.Sprint([]string{"Saved"}) {
+		t.Errorf("Expected: %v, got: %v", map[string][]string{"1-S2-1-1": {"Saved"}}, got)
+	}
+}
+
+func TestSameRoster(t *testing.T) {
+	observer := testSlot(9, "1-S2-1-9", rep.ControlHuman)
+	observer["observe"] = int64(1)
+	roster := func(slots ...s2prot.Struct) *repm.Rep {
+		return testRep(slots, nil)
+	}
+	a := roster(testSlot(0, "1-S2-1-1", rep.ControlHuman), testSlot(1, "1-S2-1-2", rep.ControlHuman))
+	cases := []struct {
+		b   *repm.Rep
+		exp bool
+	}{
+		{roster(testSlot(0, "1-S2-1-2", rep.ControlHuman), testSlot(1, "1-S2-1-1", rep.ControlHuman)), true},
+		{roster(testSlot(0, "1-S2-1-1", rep.ControlHuman), observer, testSlot(1, "1-S2-1-2", rep.ControlHuman),
+			testSlot(2, "", rep.ControlComputer)), true},
+		{roster(testSlot(0, "1-S2-1-1", rep.ControlHuman)), false},
+		{roster(testSlot(0, "1-S2-1-1", rep.ControlHuman), testSlot(1, "1-S2-1-3", rep.ControlHuman)), false},
+		{roster(testSlot(0, "1-S2-1-1", rep.ControlHuman), testSlot(1, "", rep.ControlHuman)), false},
+	}
+	for i, c := range cases {
+		if got := SameRoster(a, c.b); got != c.exp {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.exp, got)
+		}
+		if got := SameRoster(c.b, a); got != c.exp {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.exp, got)
+		}
+	}
+}
+
+func TestBanks(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		nil,
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "C"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "B"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "A"),
+	)
+
+	var got []string
+	for i, bank := range Banks(r) {
+		got = append(got, fmt.Sprint(i, bank.Name))
+	}
+	if exp := []string{"0A", "0B", "1C"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+
+	got = nil
+	for i, bank := range Banks(r) {
+		got = append(got, fmt.Sprint(i, bank.Name))
+		break
+	}
+	if exp := []string{"0A"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	bank := testBank("Dup",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "A", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "B", "type", int64(BankValueTypeInt), "data", "2"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Once", "type", int64(BankValueTypeInt), "data", "0"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "T"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "A", "type", int64(BankValueTypeInt), "data", "9"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "B", "type", int64(BankValueTypeInt), "data", "3"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "A", "type", int64(BankValueTypeInt), "data", "4"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "A", "type", int64(BankValueTypeInt), "data", "5"),
+	)
+
+	if exp, got := []string{"S/A", "S/B"}, bank.Collisions(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if got := testBankFixture().Collisions(); len(got) != 0 {
+		t.Errorf("Expected no collisions, got: %v", got)
+	}
+
+	cases := []struct {
+		opts WriteOptions
+		exp  []string // values written in order
+	}{
+		{WriteOptions{}, []string{"5", "3", "0", "9"}},
+		{WriteOptions{KeepDuplicates: true}, []string{"1", "2", "0", "9", "3", "4", "5"}},
+	}
+	for i, c := range cases {
+		buf := &bytes.Buffer{}
+		if _, err := bank.WriteToWithOptions(buf, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if _, v, ok := strings.Cut(line, `<Value int="`); ok {
+				got = append(got, strings.TrimSuffix(v, `"/>`))
+			}
+		}
+		if !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.exp, got)
+		}
+	}
+}
+
+func TestCollisionsMultiValue(t *testing.T) {
+	bank := testBank("Multi",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Once"),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "X", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "Y", "type", int64(BankValueTypeInt), "data", "2"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Twice"),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "X", "type", int64(BankValueTypeInt), "data", "3"),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "Y", "type", int64(BankValueTypeInt), "data", "4"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Twice"),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "X", "type", int64(BankValueTypeInt), "data", "5"),
+		testEvt(testEvtTypeBankValue, 0, 0, "name", "Y", "type", int64(BankValueTypeInt), "data", "6"),
+	)
+	buf := &bytes.Buffer{}
+	if _, err := bank.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{`<X int="1"/>`, `<Y int="2"/>`, `<X int="5"/>`, `<Y int="6"/>`} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("Expected: %v in\n%s", exp, buf)
+		}
+	}
+	for _, unexp := range []string{`<X int="3"/>`, `<Y int="4"/>`} {
+		if strings.Contains(buf.String(), unexp) {
+			t.Errorf("Unexpected: %v in\n%s", unexp, buf)
+		}
+	}
+}
+
+func TestListBankNames(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+			testSlot(2, "", rep.ControlComputer),
+		},
+		nil,
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Zeta"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Other"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Alpha"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Zeta"),
+		testEvt(testEvtTypeBankFile, 7, 0, "name", "Stray"),
+		testEvt(testEvtTypeBankFile, 1, 1, "name", "Late"),
+	)
+
+	got := ListBankNames(r)
+	exp := [][]string{{"Alpha", "Zeta"}, {"Other"}, nil}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	for iPlayer, playerBanks := range NewBanksFromReplay(r) {
+		if names := sortedBankNames(playerBanks); len(names) != len(got[iPlayer]) {
+			t.Errorf("[%d] Expected: %v, got: %v", iPlayer, names, got[iPlayer])
+		}
+	}
+}
+
+func TestNewBankWriteStats(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(0, "", rep.ControlComputer), // computers read as user 0
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman), testPlayer("B", 2, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankKey, 0, 100, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankFile, 7, 0, "name", "Stray"),
+	)
+
+	got := NewBankWriteStats(r)
+	exp := BankWriteStats{Total: 5, PerPlayer: []int{3, 0, 1}, InGame: 1}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if banks := NewBanksFromReplay(r); len(banks[0]) != 1 || len(banks[1]) != 0 {
+		t.Errorf("Expected bank of slot 0, got: %v", banks)
+	}
+}
+
+func TestQueriesAnonymized(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "", rep.ControlHuman), testSlot(1, "", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("", 0, rep.ControlHuman), testPlayer("", 0, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Bank"),
+		testEvt(testEvtTypeBankSection, 1, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 1, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "2"),
+		testEvt(testEvtTypeBankKey, 1, 100, "name", "K", "type", int64(BankValueTypeInt), "data", "3"),
+	)
+	banks := NewBanksFromReplay(r)
+
+	if got, exp := BankCountsByToon(banks), map[string]int{"Player0": 1, "Player1": 1}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if got, exp := CollectKeyValues(banks, "Bank", "S", "K"), map[string]string{"Player0": "1", "Player1": "2"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if got, exp := AnyPlayerHasKey(banks, "Bank", "S", "K"), []string{"Player0", "Player1"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if got, exp := ModifiedBanks(r), map[string][]string{"Player1": {"Bank"}}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestNewBanksByTeam(t *testing.T) {
+	slot := func(userID int64, toon string, teamID int64) s2prot.Struct {
+		s := testSlot(userID, toon, rep.ControlHuman)
+		if teamID >= 0 {
+			s["teamId"] = teamID
+		}
+		return s
+	}
+	r := testRep(
+		[]s2prot.Struct{slot(0, "1-S2-1-1", 0), slot(1, "1-S2-1-2", 1), slot(2, "1-S2-1-3", 0), slot(3, "1-S2-1-4", -1)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman), testPlayer("B", 2, rep.ControlHuman),
+			testPlayer("C", 3, rep.ControlHuman), testPlayer("D", 4, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 2, 0, "name", "Z"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Y"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "X"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "X"),
+		testEvt(testEvtTypeBankFile, 3, 0, "name", "X"),
+	)
+
+	got := map[int][]string{}
+	for team, banks := range NewBanksByTeam(r) {
+		for _, bank := range banks {
+			got[team] = append(got[team], bank.UserSlot.ToonHandle()+"/"+bank.Name)
+		}
+	}
+	exp := map[int][]string{
+		0: {"1-S2-1-4/X"}, // no team
+		1: {"1-S2-1-1/X", "1-S2-1-1/Y", "1-S2-1-3/Z"},
+		2: {"1-S2-1-2/X"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestBankLoadOrder(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman), testSlot(1, "", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman), testPlayer("", 0, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "B"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "A"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K"),
+		testEvt(testEvtTypeBankFile, 7, 16, "name", "C"), // of no slot
+		testEvt(testEvtTypeBankFile, 0, 32, "name", "A"),
+	)
+	exp := []BankLoad{
+		{0, "Player1", "B"},
+		{0, "1-S2-1-1", "A"},
+		{16, "", "C"},
+		{32, "1-S2-1-1", "A"},
+	}
+	if got := BankLoadOrder(r); !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestBankCounts(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman), testSlot(1, "1-S2-1-2", rep.ControlHuman), testSlot(2, "1-S2-1-3", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman), testPlayer("B", 2, rep.ControlHuman), testPlayer("C", 3, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "X"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Y"),
+		testEvt(testEvtTypeBankFile, 2, 0, "name", "X"),
+		testEvt(testEvtTypeBankFile, 0, 16, "name", "X"), // reloaded
+	)
+	banks := NewBanksFromReplay(r)
+
+	if got, exp := BankCounts(banks), []int{2, 0, 1}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	// Players without banks are left out
+	if got, exp := BankCountsByToon(banks), map[string]int{"1-S2-1-1": 2, "1-S2-1-3": 1}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if got := BankCounts(nil); len(got) != 0 {
+		t.Errorf("Expected no counts, got: %v", got)
+	}
+}
+
+func TestProgressionBanks(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman), testSlot(1, "1-S2-1-2", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman), testPlayer("B", 2, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Campaign"),
+		testEvt(testEvtTypeBankSection, 1, 0, "name", "PROGRESS"), // matched case-insensitively
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Zeta"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Options"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "achievements"), // not the first section
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Alpha"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Stats"),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Settings"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Options"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "StatsOld"), // not a whole marker
+	)
+	names := func() (ret []string) {
+		for _, bank := range ProgressionBanks(r) {
+			ret = append(ret, bank.UserSlot.ToonHandle()+"/"+bank.Name)
+		}
+		return ret
+	}
+
+	// Ordered by player index, then by bank name
+	if got, exp := names(), []string{"1-S2-1-1/Alpha", "1-S2-1-1/Zeta", "1-S2-1-2/Campaign"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+
+	defer func(markers []string) { ProgressionSectionMarkers = markers }(ProgressionSectionMarkers)
+	ProgressionSectionMarkers = append(ProgressionSectionMarkers, "options")
+	if got, exp := names(), []string{"1-S2-1-1/Alpha", "1-S2-1-1/Settings", "1-S2-1-1/Zeta", "1-S2-1-2/Campaign"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestCachedBanks(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "X"),
+	)
+	first := CachedBanks(r)
+	if len(first) != 1 || len(first[0]) != 1 || first[0]["X"] == nil {
+		t.Fatalf("Expected bank X, got: %v", first)
+	}
+
+	// Events changed after the first call are not rescanned
+	r.GameEvts = append(r.GameEvts, testEvt(testEvtTypeBankFile, 0, 0, "name", "Y"))
+	second := CachedBanks(r)
+	if len(second[0]) != 1 || second[0]["X"] != first[0]["X"] {
+		t.Errorf("Expected the cached banks, got: %v", second)
+	}
+	if fresh := NewBanksFromReplay(r); len(fresh[0]) != 2 {
+		t.Errorf("Expected: %v fresh banks, got: %v", 2, len(fresh[0]))
+	}
+}
+
+func TestLoadTime(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Loaded"),
+		testEvt(testEvtTypeBankFile, 0, 48, "name", "Saved"),
+	)
+	banks := NewBanksFromReplayUntil(r, AllLoops)[0]
+	cases := []struct {
+		name string
+		exp  time.Duration
+	}{
+		{"Loaded", 0},
+		{"Saved", 3 * time.Second}, // 16 loops a second
+	}
+	for _, c := range cases {
+		if got := banks[c.name].LoadTime(r); got != c.exp {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, c.exp, got)
+		}
+	}
+}
+
+func TestWriteToAs(t *testing.T) {
+	cases := []struct {
+		slotToon, owner string
+		exp             string // Player comment
+	}{
+		{"", "2-S2-1-9", "<!--Player: 2-S2-1-9-->"}, // re-attributed anonymized bank
+		{"1-S2-1-2", "2-S2-1-9", "<!--Player: 2-S2-1-9-->"},
+		{"1-S2-1-2", "", "<!--Player: 1-S2-1-2-->"}, // as WriteTo
+	}
+	for i, c := range cases {
+		bank := testBankFixture()
+		bank.UserSlot = rep.Slot{Struct: s2prot.Struct{"toonHandle": c.slotToon}}
+		buf := &bytes.Buffer{}
+		n, err := bank.WriteToAs(buf, c.owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("[%d] Expected: %v bytes, got: %v", i, buf.Len(), n)
+		}
+		if !strings.Contains(buf.String(), c.exp) {
+			t.Errorf("[%d] Expected: %v in\n%s", i, c.exp, buf)
+		}
+		if !strings.Contains(buf.String(), `<Value string="Raynor"/>`) {
+			t.Errorf("[%d] Expected keys, got: %v", i, buf)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package bankrecover
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// chatRecipients are the names of the recipient scopes of chat messages, indexed by the recipient recorded.
+var chatRecipients = []string{"all", "allies", "individual", "battlenet", "observers"}
+
+// ChatLine is a chat message of a replay attributed to its player, see ChatMessages.
+type ChatLine struct {
+	Loop      int64         // Game loop the message was sent at, 0 before the game started
+	Time      time.Duration // In-game time the message was sent at
+	Player    string        // Name of the player sending the message, "Player<user ID>" if not known
+	Recipient string        // Recipient scope: all, allies, individual, battlenet or observers
+	Text      string        // Text of the message
+}
+
+// ChatMessages returns the chat messages of the replay 'r' in message event order, attributed to their players,
+// for correlating what players typed with the banks they loaded.
+// Players are found by the slots of the users as banks are, so users owning no slot show as "Player<user ID>".
+// If message events were decoded with errors, the messages decoded up to the error are returned.
+func ChatMessages(r *repm.Rep) []ChatLine {
+	names := map[int64]string{} // user ID => player name
+	players := r.Details.Players()
+	for userID, iSlot := range slotIndexByUserID(r) {
+		toon := r.InitData.LobbyState.Slots[iSlot].ToonHandle()
+		for _, p := range players {
+			if toon != "" && p.Toon.String() == toon {
+				names[userID] = p.Name
+			}
+		}
+	}
+
+	var ret []ChatLine
+	for _, msg := range r.ChatMessages() {
+		name, ok := names[msg.UserID]
+		if !ok {
+			name = fmt.Sprint("Player", msg.UserID)
+		}
+		recipient := fmt.Sprint(msg.Recipient)
+		if msg.Recipient >= 0 && msg.Recipient < int64(len(chatRecipients)) {
+			recipient = chatRecipients[msg.Recipient]
+		}
+		ret = append(ret, ChatLine{
+			Loop:      msg.Loop,
+			Time:      r.LoopToDuration(msg.Loop),
+			Player:    name,
+			Recipient: recipient,
+			Text:      msg.Text,
+		})
+	}
+	return ret
+}
@@ -0,0 +1,47 @@
+package bankrecover
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+)
+
+func TestChatMessages(t *testing.T) {
+	chat := &s2prot.EvtType{Name: "Chat"}
+	msg := func(userID, loop, recipient int64, text string) s2prot.Event {
+		return s2prot.Event{EvtType: chat, Struct: s2prot.Struct{
+			"loop": loop, "userid": s2prot.Struct{"userId": userID}, "recipient": recipient, "string": text,
+		}}
+	}
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("B", 2, rep.ControlHuman),
+		},
+	)
+	r.MessageEvts = []s2prot.Event{
+		msg(0, 0, 0, "glhf"),
+		{EvtType: &s2prot.EvtType{Name: "LoadingProgress"}, Struct: s2prot.Struct{"loop": int64(0)}},
+		msg(1, 32, 1, "load your bank"),
+		msg(5, 48, 4, "hi"),
+		msg(0, 64, 9, "?"),
+	}
+	r.MessageEvtsErr = true // decoded up to an error, as they are
+
+	exp := []ChatLine{
+		{0, 0, "A", "all", "glhf"},
+		{32, 2 * time.Second, "B", "allies", "load your bank"},
+		{48, 3 * time.Second, "Player5", "observers", "hi"},
+		{64, 4 * time.Second, "A", "9", "?"},
+	}
+	if got := ChatMessages(r); !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
@@ -1,83 +1,420 @@
-package main
-
-import (
-	"flag"
-	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-
-	bankrecover "github.com/nanitefactory/sc2bankrecover"
-	"github.com/nanitefactory/sc2bankrecover/repm"
-)
-
-// Flag variables
-var (
-	flagFileName = flag.String("filename", "", "filename of a replay")
-)
-
-func init() {
-	flag.Parse()
-}
-
-func main() {
-	// args
-	if *flagFileName == "" && len(os.Args) > 1 {
-		*flagFileName = os.Args[1]
-	}
-
-	// get .
-	wd := func() string {
-		ret, err := os.Getwd()
-		if err != nil {
-			panic(err)
-		}
-		return ret
-	}()
-
-	// get rep
-	r, err := repm.NewFromFile(filepath.Join(wd, *flagFileName))
-	if err != nil {
-		fmt.Printf("Failed to open file: %v\n", err) // likely to return unsupported version error
-		return
-	}
-	defer r.Close()
-
-	// 1
-	fmt.Printf("Version:        %v\n", r.Header.VersionString())
-	fmt.Printf("Loops:          %d\n", r.Header.Loops())
-	fmt.Printf("Length:         %v\n", r.Header.Duration())
-	fmt.Printf("Map:            %s\n", r.Details.Title())
-	fmt.Printf("Speed:          %s\n", r.Details.GameSpeed())
-	fmt.Printf("Game events:    %d\n", len(r.GameEvts))
-	fmt.Printf("Message events: %d\n", len(r.MessageEvts))
-	fmt.Printf("Tracker events: %d\n", len(r.TrackerEvts.Evts))
-
-	// 2
-	fmt.Println("Players:")
-	for _, p := range r.Details.Players() {
-		fmt.Printf("\tName: %-20s, Race: %c, Team: %d, Result: %v, Toon: %v\n",
-			p.Name, p.Race().Letter, p.TeamID()+1, p.Result(), p.Toon)
-	}
-
-	// 3
-	for _, slot := range r.InitData.LobbyState.Slots {
-		fmt.Printf("\tUserID: %v, Observe: %v, Team: %d, WorkingSetSlotID: %v, Toon: %v\n",
-			slot.UserID(), slot.Observe().Name, slot.TeamID()+1, slot.WorkingSetSlotID(), slot.ToonHandle())
-	}
-
-	// 4
-	fmt.Println("Begin")
-	for iPlayer, playerBanks := range bankrecover.NewBanksFromReplay(r) {
-		for bankName, bank := range playerBanks {
-			d := fmt.Sprintf("%d__%s", iPlayer, bank.UserSlot.ToonHandle())
-			f := fmt.Sprintf("%s.SC2Bank", bankName)
-			log.Println("Save file: ", filepath.Join(d, f))
-			if err := bank.SaveAsFile(filepath.Join(wd, d, f)); err != nil {
-				panic(err)
-			}
-		}
-	}
-	fmt.Println("End")
-
-}
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bankrecover "github.com/nanitefactory/sc2bankrecover"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// Flag variables
+var (
+	flagFileName = flag.String("filename", "", "filename of a replay, or a glob pattern of replays; replays may also be given as arguments")
+	flagTemplate = flag.String("template", bankrecover.DefaultPathTemplate,
+		"layout of saved banks, placeholders: {index} {toon} {name} {bank} {map} {team} {author}")
+	flagFormat = flag.String("format", "xml",
+		"output format: xml saves .SC2Bank files, csv writes all bank keys to stdout; csv accepts a directory of replays")
+	flagPlayer   = flag.String("player", "", "save only banks of players whose name contains this, case-insensitive")
+	flagToon     = flag.String("toon", "", "save only banks of the player of this toon handle")
+	flagBank     = flag.String("bank", "", "save only banks of this name")
+	flagStdout   = flag.Bool("stdout", false, "write the only bank selected to stdout and nothing else; logs go to stderr")
+	flagOut      = flag.String("out", "", "directory to save banks under, created if missing; defaults to the working directory")
+	flagZip      = flag.String("zip", "", "zip archive to write all banks to instead of saving them as files")
+	flagStatsCSV = flag.String("stats-csv", "", "CSV file to write the macro stats of the players of replays to")
+	flagChat     = flag.Bool("chat", false, "print the chat messages of replays")
+	flagDryRun   = flag.Bool("dry-run", false, "list the files that would be written and their sizes without writing anything")
+	flagValidate = flag.Bool("validate", false, "validate banks before saving them as files, failing on invalid ones")
+)
+
+// statsCSV writes to the file of the -stats-csv flag, nil if it is not set.
+var statsCSV *bankrecover.StatsCSVWriter
+
+func init() {
+	flag.Parse()
+	bankrecover.Log = log.New(os.Stderr, "", log.LstdFlags)
+	bankrecover.ValidateOnSave = *flagValidate
+}
+
+func main() {
+	// args
+	var args []string
+	if *flagFileName != "" {
+		args = append(args, *flagFileName)
+	}
+	args = append(args, flag.Args()...)
+
+	// get .
+	wd := func() string {
+		ret, err := os.Getwd()
+		if err != nil {
+			panic(err)
+		}
+		return ret
+	}()
+	names := replayNames(args)
+
+	switch *flagFormat {
+	case "xml":
+	case "csv":
+		// Flags of saving banks as files have no meaning for CSV
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "zip", "out", "chat", "stats-csv":
+				fmt.Fprintf(os.Stderr, "-format csv does not take -%s\n", f.Name)
+				os.Exit(1)
+			}
+		})
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format: %s\n", *flagFormat)
+		os.Exit(1)
+	}
+
+	if *flagStdout {
+		if *flagFormat != "xml" {
+			fmt.Fprintln(os.Stderr, "-stdout takes -format xml")
+			os.Exit(1)
+		}
+		if len(names) != 1 {
+			fmt.Fprintln(os.Stderr, "-stdout takes a single replay")
+			os.Exit(1)
+		}
+		if err := writeStdout(wd, names[0]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *flagFormat == "csv" {
+		if err := writeCSV(wd, names); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write CSV: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *flagStatsCSV != "" && *flagDryRun {
+		log.Printf("Would save stats CSV: %s", inDir(wd, *flagStatsCSV))
+		statsCSV = bankrecover.NewStatsCSVWriter(io.Discard)
+	} else if *flagStatsCSV != "" {
+		f, err := os.Create(inDir(wd, *flagStatsCSV))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create stats CSV: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		statsCSV = bankrecover.NewStatsCSVWriter(f)
+	}
+
+	outDir := inDir(wd, *flagOut)
+	if len(names) <= 1 {
+		name := ""
+		if len(names) == 1 {
+			name = names[0]
+		}
+		if err := recoverReplay(wd, name, outDir, *flagZip); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Batch: banks of each replay go to a subdirectory named after it
+	if *flagZip != "" {
+		fmt.Fprintln(os.Stderr, "-zip takes a single replay")
+		os.Exit(1)
+	}
+	var failed int
+	subs := batchDirs(wd, names)
+	for i, name := range names {
+		fmt.Printf("Replay:         %s\n", name)
+		if err := recoverReplay(wd, name, filepath.Join(outDir, subs[i]), ""); err != nil {
+			log.Printf("%s: %v", name, err)
+			failed++
+		}
+	}
+	fmt.Printf("Replays:        %d succeeded, %d failed\n", len(names)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// inDir returns the path 'name' relative to the directory 'dir', or 'name' itself if it is absolute.
+func inDir(dir, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// replayNames returns the names of the replays the arguments 'args' give, expanding glob patterns.
+// Arguments matching no file are kept as they are, opening them tells what's wrong.
+func replayNames(args []string) []string {
+	var names []string
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil || len(matches) == 0 {
+			names = append(names, arg)
+			continue
+		}
+		names = append(names, matches...)
+	}
+	return names
+}
+
+// batchDirs returns the subdirectories the banks of the replays 'names' are saved under in batch mode,
+// 'names' being relative to the working directory 'wd' unless absolute: the paths of the replays without extensions
+// relative to the deepest directory holding them all, so replays of the same name in different directories
+// get different subdirectories.
+func batchDirs(wd string, names []string) []string {
+	paths := make([]string, len(names))
+	var common string
+	for i, name := range names {
+		paths[i] = filepath.Clean(inDir(wd, name))
+		dir := filepath.Dir(paths[i])
+		if i == 0 {
+			common = dir
+		}
+		for common != dir && !strings.HasPrefix(dir, common+string(filepath.Separator)) && common != filepath.Dir(common) {
+			common = filepath.Dir(common)
+		}
+	}
+	ret := make([]string, len(names))
+	for i, p := range paths {
+		rel, err := filepath.Rel(common, p)
+		if err != nil {
+			rel = filepath.Base(p)
+		}
+		ret[i] = strings.TrimSuffix(rel, filepath.Ext(rel))
+	}
+	return ret
+}
+
+// recoverReplay recovers the banks of the replay 'name' and saves them under the directory 'outDir',
+// or writes them to the zip archive 'zipName' if it is not empty.
+// 'name' and 'zipName' are relative to the working directory 'wd' unless they are absolute.
+func recoverReplay(wd, name, outDir, zipName string) error {
+	// get rep
+	r, err := repm.NewFromFile(inDir(wd, name))
+	if err != nil {
+		return fmt.Errorf("Failed to open file: %v", err) // likely to return unsupported version error
+	}
+	defer r.Close()
+
+	// 1
+	fmt.Printf("Version:        %v\n", r.Header.VersionString())
+	fmt.Printf("Loops:          %d\n", r.Header.Loops())
+	fmt.Printf("Length:         %v\n", r.Header.Duration())
+	fmt.Printf("Map:            %s\n", r.Details.Title())
+	fmt.Printf("Speed:          %s\n", r.Details.GameSpeed())
+	fmt.Printf("Game events:    %d\n", len(r.GameEvts))
+	fmt.Printf("Message events: %d\n", len(r.MessageEvts))
+	fmt.Printf("Tracker events: %d\n", len(r.TrackerEvts.Evts))
+
+	// 2
+	fmt.Println("Players:")
+	for _, p := range r.Details.Players() {
+		fmt.Printf("\tName: %-20s, Race: %c, Team: %d, Result: %v, Toon: %v\n",
+			p.Name, p.Race().Letter, p.TeamID()+1, p.Result(), p.Toon)
+	}
+
+	// 3
+	for _, slot := range r.InitData.LobbyState.Slots {
+		fmt.Printf("\tUserID: %v, Observe: %v, Team: %d, WorkingSetSlotID: %v, Toon: %v\n",
+			slot.UserID(), slot.Observe().Name, slot.TeamID()+1, slot.WorkingSetSlotID(), slot.ToonHandle())
+	}
+
+	if statsCSV != nil {
+		if err := statsCSV.Write(name, r); err != nil {
+			return fmt.Errorf("Failed to write stats CSV: %v", err)
+		}
+	}
+
+	if *flagChat {
+		fmt.Println("Chat:")
+		for _, line := range bankrecover.ChatMessages(r) {
+			fmt.Printf("\t%v %s (%s): %s\n", line.Time, line.Player, line.Recipient, line.Text)
+		}
+	}
+
+	// 4
+	fmt.Println("Begin")
+	banks, matched, total := filterBanks(bankrecover.NewBanksFromReplay(r))
+	if filtering() {
+		fmt.Printf("Matched banks:  %d of %d\n", matched, total)
+	}
+	if zipName != "" {
+		if *flagDryRun {
+			cw := &countingWriter{w: io.Discard}
+			if err := bankrecover.WriteArchiveZip(cw, banks); err != nil {
+				return fmt.Errorf("Failed to render archive: %v", err)
+			}
+			log.Printf("Would save archive: %s (%d bytes)", zipName, cw.n)
+			fmt.Println("End")
+			return nil
+		}
+		log.Println("Save archive: ", zipName)
+		if err := writeZip(inDir(wd, zipName), banks); err != nil {
+			return fmt.Errorf("Failed to write archive: %v", err)
+		}
+		fmt.Println("End")
+		return nil
+	}
+	if !*flagDryRun {
+		if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+			return fmt.Errorf("Failed to create output directory: %v", err)
+		}
+	}
+	for iPlayer, playerBanks := range banks {
+		for _, bank := range playerBanks {
+			p, err := bankrecover.ExpandPathTemplate(*flagTemplate, bank, iPlayer)
+			if err != nil {
+				return fmt.Errorf("Invalid template: %v", err)
+			}
+			p = filepath.FromSlash(p)
+			if *flagDryRun {
+				cw := &countingWriter{w: io.Discard}
+				if _, err := bank.WriteTo(cw); err != nil {
+					return fmt.Errorf("Failed to render bank: %v", err)
+				}
+				log.Printf("Would save file: %s (%d bytes)", filepath.Join(outDir, p), cw.n)
+				continue
+			}
+			log.Println("Save file: ", p)
+			if err := bank.SaveAsFile(filepath.Join(outDir, p)); err != nil {
+				return fmt.Errorf("Failed to save bank: %v", err)
+			}
+		}
+	}
+	fmt.Println("End")
+	return nil
+}
+
+// countingWriter counts the bytes written through it to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// writeZip writes the banks 'banks' to the zip archive file 'name'.
+func writeZip(name string, banks []map[string]*bankrecover.Bank) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := bankrecover.WriteArchiveZip(f, banks); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// filtering tells if banks are filtered with the -player, -toon or -bank flags.
+func filtering() bool {
+	return *flagPlayer != "" || *flagToon != "" || *flagBank != ""
+}
+
+// filterBanks returns the banks of 'banks', as returned by NewBanksFromReplay, of the players matching the
+// -player and -toon flags and of the name of the -bank flag, along with the number of banks kept and in total.
+// Players not matching are left with no banks so indices stay those of the replay.
+func filterBanks(banks []map[string]*bankrecover.Bank) (ret []map[string]*bankrecover.Bank, matched, total int) {
+	ret = make([]map[string]*bankrecover.Bank, len(banks))
+	for i, playerBanks := range banks {
+		ret[i] = map[string]*bankrecover.Bank{}
+		for name, bank := range playerBanks {
+			total++
+			if *flagToon != "" && bank.UserSlot.ToonHandle() != *flagToon {
+				continue
+			}
+			if *flagBank != "" && name != *flagBank {
+				continue
+			}
+			if *flagPlayer != "" && !strings.Contains(strings.ToLower(bank.PlayerName()), strings.ToLower(*flagPlayer)) {
+				continue
+			}
+			ret[i][name] = bank
+			matched++
+		}
+	}
+	return ret, matched, total
+}
+
+// writeStdout writes the only bank of the replay 'name' the filter flags select to stdout, relative to the working directory 'wd'.
+// An error is returned if no bank or more than one is selected.
+func writeStdout(wd, name string) error {
+	r, err := repm.NewFromFileEvts(inDir(wd, name), true, false, false)
+	if err != nil {
+		return fmt.Errorf("Failed to open file: %v", err)
+	}
+	defer r.Close()
+
+	banks, matched, total := filterBanks(bankrecover.NewBanksFromReplay(r))
+	if matched != 1 {
+		return fmt.Errorf("-stdout: %d of %d banks selected, select exactly one with -bank, -player or -toon", matched, total)
+	}
+	for _, playerBanks := range banks {
+		for _, bank := range playerBanks {
+			if _, err := bank.WriteTo(os.Stdout); err != nil {
+				return fmt.Errorf("Failed to write bank: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeCSV writes the bank keys of the replays 'args', or of all replays in those of them being directories, to stdout as one CSV.
+// 'args' are relative to the working directory 'wd' unless absolute.
+// Replays failing to open are logged and skipped, an error telling how many failed is returned then.
+func writeCSV(wd string, args []string) error {
+	var names []string
+	var failed int
+	for _, name := range args {
+		if fi, err := os.Stat(inDir(wd, name)); err != nil {
+			log.Printf("%s: %v", name, err)
+			failed++
+		} else if fi.IsDir() {
+			matches, err := filepath.Glob(filepath.Join(inDir(wd, name), "*.SC2Replay"))
+			if err != nil {
+				return err
+			}
+			names = append(names, matches...)
+		} else {
+			names = append(names, name)
+		}
+	}
+
+	cw := bankrecover.NewBankCSVWriter(os.Stdout)
+	for _, name := range names {
+		r, err := repm.NewFromFileEvts(inDir(wd, name), true, false, false)
+		if err != nil {
+			log.Printf("%s: %v", name, err)
+			failed++
+			continue
+		}
+		banks, matched, total := filterBanks(bankrecover.NewBanksFromReplay(r))
+		if filtering() {
+			fmt.Fprintf(os.Stderr, "%s: matched banks: %d of %d\n", name, matched, total)
+		}
+		err = cw.Write(name, banks)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d replays failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package bankrecover
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// ConfigBankName is the name of the banks ConfigBanks returns.
+const ConfigBankName = "MapConfig"
+
+// attrNamespaceStandard is the namespace of the attributes defined by the game, as opposed to those a map defines.
+const attrNamespaceStandard = 999
+
+// attrScopeGlobal is the scope of the attributes of the game as a whole, player scopes are numbered from 1.
+const attrScopeGlobal = 16
+
+// Event types of the bank events ConfigBanks synthesizes.
+var (
+	configEvtTypeBankFile    = &s2prot.EvtType{Name: EvtTypeBankFile}
+	configEvtTypeBankSection = &s2prot.EvtType{Name: EvtTypeBankSection}
+	configEvtTypeBankKey     = &s2prot.EvtType{Name: EvtTypeBankKey}
+)
+
+// ConfigBanks returns the attributes the map of the replay 'r' defines, e.g. its lobby options, as banks named ConfigBankName.
+// Some maps keep small bank-like config there instead of in banks, which NewBanksFromReplay can't see.
+// Attributes are map-defined when they are of a namespace other than the one of the attributes of the game.
+//
+// A bank is returned for each attribute scope having map-defined attributes:
+// the global scope first, owned by no slot, then the scopes of players ordered by slot, owned by their slots.
+// A bank has a section "Namespace<namespace>" for each namespace, holding a string key "Attr<attribute ID>"
+// for each attribute, ordered by ID, whose value is the attribute value as recorded.
+//
+// It is best-effort: what the attributes mean is up to the map, and their values are 4-character codes
+// the map chose rather than bank values.
+func ConfigBanks(r *repm.Rep) []*Bank {
+	type attr struct {
+		namespace, id int64
+		value         string
+	}
+	byScope := map[int][]attr{}
+	for scope, v := range r.AttrEvts.Structv("scopes") {
+		iScope, err := strconv.Atoi(scope)
+		if err != nil {
+			continue
+		}
+		attrs, _ := v.(s2prot.Struct)
+		for _, a := range attrs {
+			a, _ := a.(s2prot.Struct)
+			if a == nil || a.Int("namespace") == attrNamespaceStandard {
+				continue
+			}
+			byScope[iScope] = append(byScope[iScope], attr{a.Int("namespace"), a.Int("attrid"), a.Stringv("value")})
+		}
+	}
+
+	var scopes []int
+	for scope := range byScope {
+		scopes = append(scopes, scope)
+	}
+	sort.Slice(scopes, func(i, j int) bool {
+		// Global scope first
+		if (scopes[i] == attrScopeGlobal) != (scopes[j] == attrScopeGlobal) {
+			return scopes[i] == attrScopeGlobal
+		}
+		return scopes[i] < scopes[j]
+	})
+
+	var ret []*Bank
+	slots := r.InitData.LobbyState.Slots
+	for _, scope := range scopes {
+		attrs := byScope[scope]
+		sort.Slice(attrs, func(i, j int) bool {
+			if attrs[i].namespace != attrs[j].namespace {
+				return attrs[i].namespace < attrs[j].namespace
+			}
+			return attrs[i].id < attrs[j].id
+		})
+
+		var slot rep.Slot
+		var player rep.Player
+		if scope != attrScopeGlobal && scope >= 1 && scope <= len(slots) {
+			slot = slots[scope-1]
+			for _, p := range r.Details.Players() {
+				if toon := p.Toon.String(); toon != "" && toon == slot.ToonHandle() {
+					player = p
+				}
+			}
+		}
+		newEvt := func(evtType *s2prot.EvtType, fields ...interface{}) s2prot.Event {
+			s := s2prot.Struct{"loop": int64(0), "userid": s2prot.Struct{"userId": slot.UserID()}}
+			for i := 0; i+1 < len(fields); i += 2 {
+				s[fields[i].(string)] = fields[i+1]
+			}
+			return s2prot.Event{Struct: s, EvtType: evtType}
+		}
+
+		bank := NewBank(r, newEvt(configEvtTypeBankFile, "name", ConfigBankName), slot, player)
+		for i, a := range attrs {
+			if i == 0 || a.namespace != attrs[i-1].namespace {
+				bank.AddGameEvent(newEvt(configEvtTypeBankSection, "name", fmt.Sprint("Namespace", a.namespace)))
+			}
+			bank.AddGameEvent(newEvt(configEvtTypeBankKey,
+				"name", fmt.Sprint("Attr", a.id), "type", int64(BankValueTypeString), "data", a.value))
+		}
+		ret = append(ret, bank)
+	}
+	return ret
+}
@@ -0,0 +1,66 @@
+package bankrecover
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+)
+
+func TestConfigBanks(t *testing.T) {
+	attr := func(namespace, id int64, value string) s2prot.Struct {
+		return s2prot.Struct{"namespace": namespace, "attrid": id, "value": value}
+	}
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("B", 2, rep.ControlHuman),
+		},
+	)
+	r.AttrEvts = rep.NewAttrEvts(s2prot.Struct{"scopes": s2prot.Struct{
+		"1": s2prot.Struct{
+			"3004":  attr(999, 3004, "Medi"),
+			"10002": attr(4242, 10002, "Hard"),
+		},
+		"2": s2prot.Struct{
+			"3004": attr(999, 3004, "Medi"),
+		},
+		"16": s2prot.Struct{
+			"3009":  attr(999, 3009, "Cust"),
+			"10001": attr(4242, 10001, "Long"),
+			"10000": attr(4242, 10000, "Fast"),
+			"20000": attr(77, 20000, "On"),
+		},
+	}})
+
+	banks := ConfigBanks(r)
+	var got []string
+	for _, bank := range banks {
+		for _, fk := range FlattenPlayerBanks(map[string]*Bank{bank.Name: bank}) {
+			got = append(got, fmt.Sprint(bank.UserSlot.ToonHandle(), ":", fk.Section, ".", fk.Key, "=", fk.Value))
+		}
+	}
+	exp := []string{
+		":Namespace77.Attr20000=On",
+		":Namespace4242.Attr10000=Fast",
+		":Namespace4242.Attr10001=Long",
+		"1-S2-1-1:Namespace4242.Attr10002=Hard",
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if len(banks) == 2 && banks[1].Player.Name != "A" {
+		t.Errorf("Expected: %v, got: %v", "A", banks[1].Player.Name)
+	}
+
+	r.AttrEvts = rep.AttrEvts{}
+	if banks := ConfigBanks(r); len(banks) != 0 {
+		t.Errorf("Expected no banks, got: %v", banks)
+	}
+}
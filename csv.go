@@ -0,0 +1,117 @@
+package bankrecover
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/icza/s2prot/rep"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// bankCSVHeader is the header row of bank CSVs.
+var bankCSVHeader = []string{"replay", "toon", "bank", "section", "key", "type", "value"}
+
+// BankCSVWriter writes the keys of banks of any number of replays into one CSV
+// with the columns replay, toon, bank, section, key, type and value.
+type BankCSVWriter struct {
+	w          *csv.Writer
+	headerDone bool
+}
+
+// NewBankCSVWriter returns a new BankCSVWriter writing to 'w'.
+func NewBankCSVWriter(w io.Writer) *BankCSVWriter {
+	return &BankCSVWriter{w: csv.NewWriter(w)}
+}
+
+// Write writes a row for every value of every key in 'banks', as returned by NewBanksFromReplay,
+// having 'replay' in the replay column. The header row is written before the first row.
+// Rows are flushed before returning.
+func (cw *BankCSVWriter) Write(replay string, banks []map[string]*Bank) error {
+	if !cw.headerDone {
+		if err := cw.w.Write(bankCSVHeader); err != nil {
+			return err
+		}
+		cw.headerDone = true
+	}
+	for _, playerBanks := range banks {
+		for _, fk := range FlattenPlayerBanks(playerBanks) {
+			toon := playerBanks[fk.Bank].UserSlot.ToonHandle()
+			if err := cw.w.Write([]string{replay, toon, fk.Bank, fk.Section, fk.Key, fk.Type.String(), fk.Value}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// WriteBankCSV writes the keys of 'banks' recovered from the replay 'r' as a CSV with a header row.
+// The replay column holds the map title, use BankCSVWriter to identify replays otherwise
+// or to write multiple replays into one CSV.
+func WriteBankCSV(w io.Writer, r *repm.Rep, banks []map[string]*Bank) error {
+	return NewBankCSVWriter(w).Write(r.Details.Title(), banks)
+}
+
+// statsCSVHeader is the header row of stats CSVs.
+var statsCSVHeader = []string{"replay", "toon", "sq", "supply_capped_percent", "start_x", "start_y", "start_clock"}
+
+// StatsCSVWriter writes the macro stats of the players of any number of replays, calculated from tracker events,
+// into one CSV with the columns replay, toon, sq, supply_capped_percent, start_x, start_y and start_clock.
+type StatsCSVWriter struct {
+	w          *csv.Writer
+	headerDone bool
+}
+
+// NewStatsCSVWriter returns a new StatsCSVWriter writing to 'w'.
+func NewStatsCSVWriter(w io.Writer) *StatsCSVWriter {
+	return &StatsCSVWriter{w: csv.NewWriter(w)}
+}
+
+// Write writes a row for every player of the replay 'r' having a player description in its tracker events,
+// having 'replay' in the replay column, ordered by slot. The start clock is the start direction as an hour of the clock.
+// Nothing but the header is written if tracker events of 'r' were not decoded.
+// The header row is written before the first row. Rows are flushed before returning.
+func (sw *StatsCSVWriter) Write(replay string, r *repm.Rep) error {
+	if !sw.headerDone {
+		if err := sw.w.Write(statsCSVHeader); err != nil {
+			return err
+		}
+		sw.headerDone = true
+	}
+	if r.TrackerEvts != nil {
+		pds := make([]*rep.PlayerDesc, 0, len(r.TrackerEvts.PIDPlayerDescMap))
+		for _, pd := range r.TrackerEvts.PIDPlayerDescMap {
+			pds = append(pds, pd)
+		}
+		sort.Slice(pds, func(i, j int) bool {
+			if pds[i].SlotID != pds[j].SlotID {
+				return pds[i].SlotID < pds[j].SlotID
+			}
+			return pds[i].PlayerID < pds[j].PlayerID
+		})
+		slots := r.InitData.LobbyState.Slots
+		for _, pd := range pds {
+			var toon string
+			if pd.SlotID >= 0 && pd.SlotID < int64(len(slots)) {
+				toon = slots[pd.SlotID].ToonHandle()
+			}
+			if err := sw.w.Write([]string{replay, toon,
+				strconv.Itoa(int(pd.SQ)), strconv.Itoa(int(pd.SupplyCappedPercent)),
+				strconv.FormatInt(pd.StartLocX, 10), strconv.FormatInt(pd.StartLocY, 10), strconv.Itoa(int(pd.StartDir)),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	sw.w.Flush()
+	return sw.w.Error()
+}
+
+// WriteStatsCSV writes the macro stats of the players of the replay 'r' as a CSV with a header row.
+// The replay column holds the map title, use StatsCSVWriter to identify replays otherwise
+// or to write multiple replays into one CSV.
+func WriteStatsCSV(w io.Writer, r *repm.Rep) error {
+	return NewStatsCSVWriter(w).Write(r.Details.Title(), r)
+}
@@ -0,0 +1,63 @@
+package bankrecover
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+func TestBankCSVWriter(t *testing.T) {
+	bank := testBank("Bank",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Quote", "type", int64(BankValueTypeString), "data", `a,"b"`),
+	)
+	bank.UserSlot = rep.Slot{Struct: s2prot.Struct{"toonHandle": "1-S2-1-1"}}
+	banks := []map[string]*Bank{{"Bank": bank}}
+
+	buf := &bytes.Buffer{}
+	cw := NewBankCSVWriter(buf)
+	if err := cw.Write("a.SC2Replay", banks); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := cw.Write("b.SC2Replay", banks); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	exp := "replay,toon,bank,section,key,type,value\n" +
+		`a.SC2Replay,1-S2-1-1,Bank,S,Quote,string,"a,""b"""` + "\n" +
+		`b.SC2Replay,1-S2-1-1,Bank,S,Quote,string,"a,""b"""` + "\n"
+	if got := buf.String(); got != exp {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestStatsCSVWriter(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		nil,
+	)
+	r.TrackerEvts = &repm.TrackerEvts{PIDPlayerDescMap: map[int64]*rep.PlayerDesc{
+		2: {PlayerID: 2, SlotID: 1, StartLocX: 30, StartLocY: 40, StartDir: 7, SQ: 80, SupplyCappedPercent: 5},
+		1: {PlayerID: 1, SlotID: 0, StartLocX: 10, StartLocY: 20, StartDir: 1, SQ: 95, SupplyCappedPercent: 12},
+	}}
+
+	buf := &bytes.Buffer{}
+	sw := NewStatsCSVWriter(buf)
+	if err := sw.Write("a.SC2Replay", r); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := sw.Write("b.SC2Replay", testRep(nil, nil)); err != nil { // no tracker events
+		t.Errorf("Unexpected error: %v", err)
+	}
+	exp := "replay,toon,sq,supply_capped_percent,start_x,start_y,start_clock\n" +
+		"a.SC2Replay,1-S2-1-1,95,12,10,20,1\n" +
+		"a.SC2Replay,1-S2-1-2,80,5,30,40,7\n"
+	if got := buf.String(); got != exp {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
@@ -0,0 +1,86 @@
+package bankrecover
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Equal tells if this bank and 'other' have the same name and content: the same sections, keys and values
+// of the same names, types and data, in the same order, and the same signature.
+// Order matters since it is the order of writes, which the game keeps; repeated writes count as well.
+// Provenance is not compared: the replay, the owner slot and player and the load loop.
+// Sections are built with the default ModelOptions. See Diff for what differs.
+func (bank *Bank) Equal(other *Bank) bool {
+	return bank.EqualWithOptions(other, ModelOptions{})
+}
+
+// EqualWithOptions is like Equal, but sections of both banks are built with the options 'opts'.
+func (bank *Bank) EqualWithOptions(other *Bank, opts ModelOptions) bool {
+	return len(bank.DiffWithOptions(other, opts)) == 0
+}
+
+// Diff returns the differences between this bank and 'other' as Equal compares them,
+// a human-readable line for each, e.g. `section 1: key 0: name "Level" != "Rank"`.
+// Once a section differs in its number of keys, or a key in its number of values, the rest of it is not compared.
+// Returns nil if the banks are equal.
+func (bank *Bank) Diff(other *Bank) []string {
+	return bank.DiffWithOptions(other, ModelOptions{})
+}
+
+// DiffWithOptions is like Diff, but sections of both banks are built with the options 'opts',
+// so e.g. values differing only in surrounding whitespace are equal with ModelOptions.TrimSpace.
+func (bank *Bank) DiffWithOptions(other *Bank, opts ModelOptions) []string {
+	var diffs []string
+	report := func(format string, v ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, v...))
+	}
+
+	if bank.Name != other.Name {
+		report("name: %q != %q", bank.Name, other.Name)
+	}
+	ss1, ss2 := bank.SectionsWithOptions(opts), other.SectionsWithOptions(opts)
+	if len(ss1) != len(ss2) {
+		report("sections: %d != %d", len(ss1), len(ss2))
+	}
+	for i := 0; i < len(ss1) && i < len(ss2); i++ {
+		s1, s2 := ss1[i], ss2[i]
+		if s1.Name != s2.Name {
+			report("section %d: name %q != %q", i, s1.Name, s2.Name)
+		}
+		if len(s1.Keys) != len(s2.Keys) {
+			report("section %d: keys: %d != %d", i, len(s1.Keys), len(s2.Keys))
+			continue
+		}
+		for j := range s1.Keys {
+			k1, k2 := s1.Keys[j], s2.Keys[j]
+			if k1.Name != k2.Name {
+				report("section %d: key %d: name %q != %q", i, j, k1.Name, k2.Name)
+			}
+			if len(k1.Values) != len(k2.Values) {
+				report("section %d: key %d: values: %d != %d", i, j, len(k1.Values), len(k2.Values))
+				continue
+			}
+			for k := range k1.Values {
+				v1, v2 := k1.Values[k], k2.Values[k]
+				if v1.Name != v2.Name {
+					report("section %d: key %d: value %d: name %q != %q", i, j, k, v1.Name, v2.Name)
+				}
+				if v1.Type != v2.Type {
+					report("section %d: key %d: value %d: type %s != %s", i, j, k, v1.Type, v2.Type)
+				}
+				if v1.Data != v2.Data {
+					report("section %d: key %d: value %d: data %q != %q", i, j, k, v1.Data, v2.Data)
+				}
+			}
+		}
+	}
+
+	sig1, sig2 := bank.SignatureBytes(), other.SignatureBytes()
+	switch {
+	case (sig1 == nil) != (sig2 == nil):
+		report("signature: present %v != %v", sig1 != nil, sig2 != nil)
+	case !bytes.Equal(sig1, sig2):
+		report("signature: %X != %X", sig1, sig2)
+	}
+	return diffs
+}
@@ -0,0 +1,73 @@
+package bankrecover
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEqualDiff(t *testing.T) {
+	other := testBankFixture()
+	other.LoadLoop = 16 // provenance, not compared
+	renamed := testBankFixture()
+	renamed.Name = "Other"
+
+	cases := []struct {
+		bank *Bank
+		exp  []string
+	}{
+		{other, nil},
+		{renamed, []string{`name: "Fixture" != "Other"`}},
+		{testBankFixture().TransformValues(func(section, key string, typ BankValueType, value string) string {
+			if key == "Hero" {
+				return "Kerrigan"
+			}
+			return value
+		}), []string{`section 0: key 1: value 0: data "Raynor" != "Kerrigan"`}},
+		{testBank("Fixture",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "Stats"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "Rank", "type", int64(BankValueTypeFixed), "data", "12"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "Hero", "type", int64(BankValueTypeString), "data", "Raynor"),
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "Gear"),
+		), []string{
+			`section 0: key 0: name "Level" != "Rank"`,
+			`section 0: key 0: value 0: type int != fixed`,
+			`section 1: name "Items" != "Gear"`,
+			`section 1: keys: 1 != 0`,
+			`signature: present true != false`,
+		}},
+		{testBank("Fixture"), []string{"sections: 2 != 0", "signature: present true != false"}},
+	}
+	for i, c := range cases {
+		got := testBankFixture().Diff(c.bank)
+		if !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.exp, got)
+		}
+		if eq := testBankFixture().Equal(c.bank); eq != (c.exp == nil) {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.exp == nil, eq)
+		}
+	}
+
+	signed := func(sig ...interface{}) *Bank {
+		return testBank("Signed", testEvt(testEvtTypeBankSignature, 0, 0, "signature", sig))
+	}
+	if got, exp := signed(int64(1)).Diff(signed(int64(2))), []string{"signature: 01 != 02"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+
+	// Padded values differ unless trimmed
+	padded := testBankFixture().TransformValues(func(section, key string, typ BankValueType, value string) string {
+		if key == "Hero" {
+			return " Raynor "
+		}
+		return value
+	})
+	if got, exp := testBankFixture().Diff(padded), []string{`section 0: key 1: value 0: data "Raynor" != " Raynor "`}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if got := testBankFixture().DiffWithOptions(padded, ModelOptions{TrimSpace: true}); got != nil {
+		t.Errorf("Expected: %v, got: %v", nil, got)
+	}
+	if !testBankFixture().EqualWithOptions(padded, ModelOptions{TrimSpace: true}) {
+		t.Errorf("Expected equal with TrimSpace")
+	}
+}
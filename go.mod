@@ -1,6 +1,6 @@
 module github.com/nanitefactory/sc2bankrecover
 
-go 1.15
+go 1.23
 
 require (
 	github.com/beevik/etree v1.1.0
@@ -0,0 +1,76 @@
+package bankrecover
+
+import (
+	"sort"
+
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// Recovery statuses of index entries.
+const (
+	IndexStatusOK         = "ok"           // Banks recovered without warnings
+	IndexStatusWarnings   = "warnings"     // Banks recovered, with warnings
+	IndexStatusPartial    = "partial"      // Game events were decoded with errors, banks may be partial
+	IndexStatusNoGameEvts = "no-game-evts" // Game events were not decoded, nothing to recover from
+)
+
+// ReplayIndexEntry is a compact description of a replay and the banks recovered from it,
+// meant to be appended to a persistent index of an archive, e.g. as a line of JSON.
+// Its JSON encoding is stable: fields are in a fixed order, and lists are in a fixed order.
+type ReplayIndexEntry struct {
+	ID      string              `json:"id"`      // ID of the replay, see repm.Rep.ID
+	Map     string              `json:"map"`     // Map title
+	Players []ReplayIndexPlayer `json:"players"` // Players, in the order of the details of the replay
+	Banks   []string            `json:"banks"`   // Names of the banks of all players, sorted and distinct
+	Status  string              `json:"status"`  // Recovery status, one of the IndexStatus constants
+}
+
+// ReplayIndexPlayer is a player of a ReplayIndexEntry.
+type ReplayIndexPlayer struct {
+	Name string `json:"name"`
+	Toon string `json:"toon"`
+}
+
+// IndexReplay recovers the banks of the replay 'r' and returns its index entry.
+// Warnings met while recovering set the status and are not logged.
+// Together with the ID of the entry, an indexer can tell replays already indexed and skip them.
+func IndexReplay(r *repm.Rep) ReplayIndexEntry {
+	entry := ReplayIndexEntry{
+		ID:      r.ID(),
+		Map:     r.Details.Title(),
+		Players: []ReplayIndexPlayer{},
+		Banks:   []string{},
+		Status:  IndexStatusOK,
+	}
+	for _, p := range r.Details.Players() {
+		entry.Players = append(entry.Players, ReplayIndexPlayer{Name: p.Name, Toon: p.Toon.String()})
+	}
+	if r.GameEvts == nil {
+		entry.Status = IndexStatusNoGameEvts
+		return entry
+	}
+
+	var warnings int
+	var stats RecoveryStats
+	banks := recoverBanks(r, 0, LoggerFunc(func(format string, v ...interface{}) {
+		warnings++
+	}), &stats, nil)
+	names := map[string]bool{}
+	for _, playerBanks := range banks {
+		for name := range playerBanks {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		entry.Banks = append(entry.Banks, name)
+	}
+	sort.Strings(entry.Banks)
+
+	switch {
+	case stats.Partial:
+		entry.Status = IndexStatusPartial
+	case warnings > 0:
+		entry.Status = IndexStatusWarnings
+	}
+	return entry
+}
@@ -0,0 +1,53 @@
+package bankrecover
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+)
+
+func TestIndexReplay(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "1-S2-1-2", rep.ControlHuman),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("B", 2, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Save"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Save"),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Config"),
+	)
+	r.Details.Struct["title"] = "Map"
+
+	entry := IndexReplay(r)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"id":"` + r.ID() + `","map":"Map",` +
+		`"players":[{"name":"A","toon":"1-S2-1-1"},{"name":"B","toon":"1-S2-1-2"}],` +
+		`"banks":["Config","Save"],"status":"ok"}`
+	if got := string(data); got != exp {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+
+	cases := []struct {
+		prep func()
+		exp  string
+	}{
+		{func() { r.GameEvts = append(r.GameEvts, testEvt(testEvtTypeBankFile, 7, 0, "name", "Stray")) }, IndexStatusWarnings},
+		{func() { r.GameEvtsErr = true }, IndexStatusPartial},
+		{func() { r.GameEvts = nil }, IndexStatusNoGameEvts},
+	}
+	for i, c := range cases {
+		c.prep()
+		if got := IndexReplay(r).Status; got != c.exp {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.exp, got)
+		}
+	}
+}
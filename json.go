@@ -0,0 +1,73 @@
+package bankrecover
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonBank is the JSON schema of a bank written by WriteJSON.
+type jsonBank struct {
+	Name      string        `json:"name"`
+	Sections  []jsonSection `json:"sections"`
+	Signature *string       `json:"signature"`
+}
+
+// jsonSection is a section of a jsonBank.
+type jsonSection struct {
+	Name string    `json:"name"`
+	Keys []jsonKey `json:"keys"`
+}
+
+// jsonKey is a key of a jsonSection.
+type jsonKey struct {
+	Name   string      `json:"name"`
+	Values []jsonValue `json:"values"`
+}
+
+// jsonValue is a typed value of a jsonKey.
+type jsonValue struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// WriteJSON writes out this bank to the writer 'w' as a JSON object of the form
+//
+//	{"name": "Bank", "sections": [{"name": "Section", "keys": [{"name": "Key",
+//	    "values": [{"name": "Value", "type": "int", "value": "1"}]}]}], "signature": "AB01"}
+//
+// where the type of a value is the attribute name of its value type as in .SC2Bank files
+// and its value is the data as written in .SC2Bank files, always a string.
+// Sections and keys written more than once are merged as WriteTo merges them by default, a key holding the values of its last write,
+// see Collisions; they are in order of first write.
+// The signature is in upper-case hex, empty for an empty signature, and null if the bank has no signature event.
+// A bank having no sections has an empty "sections" array.
+// The function returns the number of bytes written and any error encountered.
+func (bank *Bank) WriteJSON(w io.Writer) (n int64, err error) {
+	jb := jsonBank{Name: bank.Name, Sections: []jsonSection{}}
+	for _, section := range collapseSections(bank.Sections()) {
+		js := jsonSection{Name: section.Name, Keys: []jsonKey{}}
+		for _, key := range section.Keys {
+			jk := jsonKey{Name: key.Name, Values: []jsonValue{}}
+			for _, v := range key.Values {
+				jk.Values = append(jk.Values, jsonValue{Name: v.Name, Type: v.Type.String(), Value: v.Data})
+			}
+			js.Keys = append(js.Keys, jk)
+		}
+		jb.Sections = append(jb.Sections, js)
+	}
+	if sig := bank.SignatureBytes(); sig != nil {
+		hex := fmt.Sprintf("%X", sig)
+		jb.Signature = &hex
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(jb); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
@@ -0,0 +1,55 @@
+package bankrecover
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	cases := []struct {
+		bank *Bank
+		exp  string
+	}{
+		{testBank("Empty"), `{"name":"Empty","sections":[],"signature":null}`},
+		{testBank("Unsigned",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankSignature, 0, 0, "signature", []interface{}{}),
+		), `{"name":"Unsigned","sections":[{"name":"S","keys":[]}],"signature":""}`},
+		{testBankFixture(), `{"name":"Fixture","sections":[
+			{"name":"Stats","keys":[
+				{"name":"Level","values":[{"name":"Value","type":"int","value":"12"}]},
+				{"name":"Hero","values":[{"name":"Value","type":"string","value":"Raynor"}]}]},
+			{"name":"Items","keys":[
+				{"name":"Sword","values":[{"name":"Value","type":"flag","value":"1"}]}]}],
+			"signature":"AB01"}`},
+		{testBank("Repeated",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "2"),
+		), `{"name":"Repeated","sections":[{"name":"S","keys":[
+			{"name":"K","values":[{"name":"Value","type":"int","value":"2"}]}]}],"signature":null}`},
+	}
+	for i, c := range cases {
+		buf := &bytes.Buffer{}
+		n, err := c.bank.WriteJSON(buf)
+		if err != nil {
+			t.Errorf("[%d] Unexpected error: %v", i, err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("[%d] Expected: %v, got: %v", i, buf.Len(), n)
+		}
+		var got, exp interface{}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Errorf("[%d] Unexpected error: %v", i, err)
+		}
+		if err := json.Unmarshal([]byte(c.exp), &exp); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("[%d] Expected: %v, got: %v", i, exp, got)
+		}
+	}
+}
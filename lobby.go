@@ -0,0 +1,38 @@
+package bankrecover
+
+import (
+	"github.com/icza/s2prot/rep"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// SlotInfo describes a lobby slot of a replay as banks are mapped to it, see LobbyLayout.
+type SlotInfo struct {
+	Index    int          // Index of the slot, that of the banks of NewBanksFromReplay
+	UserID   int64        // User ID of the slot
+	Toon     string       // Toon handle of the slot, empty for computers, open slots and anonymized replays
+	Control  *rep.Control // Control of the slot
+	Observer bool         // Tells if the slot is of an observer, a spectator or a referee
+	BankUser bool         // Tells if bank events of the user are attributed to the slot
+}
+
+// LobbyLayout returns the lobby slots of the replay 'r' in slot order, telling players from observers.
+// NewBanksFromReplay returns banks for every slot, players and observers alike as well as open and computer slots,
+// so it returns more entries than there are players; BankUser tells the slots bank events may be attributed to.
+// The lobby allows up to MaxObservers of the game description of observer slots.
+func LobbyLayout(r *repm.Rep) []SlotInfo {
+	bankUsers := slotIndexByUserID(r)
+	slots := r.InitData.LobbyState.Slots
+	ret := make([]SlotInfo, len(slots))
+	for i, slot := range slots {
+		iSlot, ok := bankUsers[slot.UserID()]
+		ret[i] = SlotInfo{
+			Index:    i,
+			UserID:   slot.UserID(),
+			Toon:     slot.ToonHandle(),
+			Control:  slot.Control(),
+			Observer: slot.Observe() != rep.ObserveParticipant,
+			BankUser: ok && iSlot == i,
+		}
+	}
+	return ret
+}
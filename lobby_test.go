@@ -0,0 +1,38 @@
+package bankrecover
+
+import (
+	"testing"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+)
+
+func TestLobbyLayout(t *testing.T) {
+	observer := testSlot(2, "1-S2-1-3", rep.ControlHuman)
+	observer["observe"] = int64(1)
+	r := testRep(
+		[]s2prot.Struct{
+			testSlot(0, "1-S2-1-1", rep.ControlHuman),
+			testSlot(1, "", rep.ControlComputer),
+			observer,
+			testSlot(3, "", rep.ControlOpen),
+		},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman)},
+	)
+
+	exp := []SlotInfo{
+		{0, 0, "1-S2-1-1", rep.ControlHuman, false, true},
+		{1, 1, "", rep.ControlComputer, false, false},
+		{2, 2, "1-S2-1-3", rep.ControlHuman, true, true},
+		{3, 3, "", rep.ControlOpen, false, false},
+	}
+	got := LobbyLayout(r)
+	if len(got) != len(exp) {
+		t.Fatalf("Expected: %v, got: %v", exp, got)
+	}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("[%d] Expected: %v, got: %v", i, exp[i], got[i])
+		}
+	}
+}
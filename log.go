@@ -0,0 +1,26 @@
+package bankrecover
+
+// Logger is where the package reports recovery warnings and debug output.
+// *log.Logger of the standard library implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Log is the logger of the package, discarding everything by default.
+// Set it to embed the package into an application with its own logging, e.g.
+//
+//	bankrecover.Log = log.New(os.Stderr, "", log.LstdFlags)
+var Log Logger = nopLogger{}
+
+// nopLogger is a Logger discarding everything.
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
+
+// LoggerFunc adapts a Printf-like function to be a Logger.
+type LoggerFunc func(format string, v ...interface{})
+
+// Printf calls f(format, v...).
+func (f LoggerFunc) Printf(format string, v ...interface{}) {
+	f(format, v...)
+}
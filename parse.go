@@ -0,0 +1,69 @@
+package bankrecover
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// ParseBankFileStream parses the .SC2Bank file read from 'r' and calls 'fn' with every value of every key
+// in document order. Unlike building an element tree, it decodes token by token,
+// so memory use stays bounded however large the bank is.
+// Parsing stops at the first error returned by 'fn', and that error is returned.
+func ParseBankFileStream(r io.Reader, fn func(section, key, value string, typ BankValueType) error) error {
+	dec := xml.NewDecoder(r)
+	var section, key string
+	var inKey bool
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("parse bank: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case tok.Name.Local == "Section":
+				section, inKey = attrValue(tok, "name"), false
+			case tok.Name.Local == "Key":
+				key, inKey = attrValue(tok, "name"), true
+			case inKey:
+				for _, attr := range tok.Attr {
+					typ, ok := parseBankValueType(attr.Name.Local)
+					if !ok {
+						continue
+					}
+					if err := fn(section, key, attr.Value, typ); err != nil {
+						return err
+					}
+				}
+			}
+		case xml.EndElement:
+			if tok.Name.Local == "Key" {
+				inKey = false
+			}
+		}
+	}
+}
+
+// attrValue returns the value of the attribute 'name' of the element 'elem', or "" if it has no such attribute.
+func attrValue(elem xml.StartElement, name string) string {
+	for _, attr := range elem.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// parseBankValueType returns the value type having the attribute name 'name' as used in .SC2Bank files.
+func parseBankValueType(name string) (BankValueType, bool) {
+	for i, typeName := range bankValueTypeNames {
+		if typeName == name {
+			return BankValueType(i), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,58 @@
+package bankrecover
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseBankFileStream(t *testing.T) {
+	type value struct {
+		section, key, value string
+		typ                 BankValueType
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := testBankFixture().WriteTo(buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got []value
+	err := ParseBankFileStream(buf, func(section, key, v string, typ BankValueType) error {
+		got = append(got, value{section, key, v, typ})
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	cases := []value{
+		{"Stats", "Level", "12", BankValueTypeInt},
+		{"Stats", "Hero", "Raynor", BankValueTypeString},
+		{"Items", "Sword", "1", BankValueTypeFlag},
+	}
+	if len(got) != len(cases) {
+		t.Fatalf("Expected: %v, got: %v", cases, got)
+	}
+	for i, c := range cases {
+		if got[i] != c {
+			t.Errorf("Expected: %v, got: %v", c, got[i])
+		}
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = ParseBankFileStream(strings.NewReader(`<Bank><Section name="S"><Key name="A"><Value int="1"/></Key><Key name="B"><Value int="2"/></Key></Section></Bank>`),
+		func(section, key, v string, typ BankValueType) error {
+			calls++
+			return errStop
+		})
+	if err != errStop || calls != 1 {
+		t.Errorf("Expected: %v, got: %v (%d calls)", errStop, err, calls)
+	}
+
+	err = ParseBankFileStream(strings.NewReader(`<Bank><Section name="S">`), func(string, string, string, BankValueType) error { return nil })
+	if err == nil {
+		t.Errorf("Expected error for truncated bank")
+	}
+}
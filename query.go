@@ -0,0 +1,294 @@
+package bankrecover
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// ProgressionSectionMarkers are section names telling that a bank stores player progression.
+// They are matched case-insensitively. Extend it with the section names of maps of interest.
+var ProgressionSectionMarkers = []string{
+	"Achievements",
+	"Achievement",
+	"Stats",
+	"Statistics",
+	"Progress",
+	"Progression",
+	"Unlocks",
+	"Leaderboard",
+	"Records",
+	"Rank",
+}
+
+// ProgressionBanks returns the banks of all players in the replay 'r' that have a section named after
+// any of ProgressionSectionMarkers. It is a heuristic for identifying progression banks
+// without knowing the exact bank names of a map.
+// Banks are ordered by player index, then by bank name.
+func ProgressionBanks(r *repm.Rep) []*Bank {
+	isMarker := func(sectionName string) bool {
+		for _, marker := range ProgressionSectionMarkers {
+			if strings.EqualFold(sectionName, marker) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var ret []*Bank
+	for _, playerBanks := range NewBanksFromReplay(r) {
+		for _, name := range sortedBankNames(playerBanks) {
+			for _, section := range playerBanks[name].Sections() {
+				if isMarker(section.Name) {
+					ret = append(ret, playerBanks[name])
+					break
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// sortedBankNames returns the names of the banks 'playerBanks' in ascending order.
+func sortedBankNames(playerBanks map[string]*Bank) []string {
+	names := make([]string, 0, len(playerBanks))
+	for name := range playerBanks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ListBankNames returns the names of the banks of all players in the replay 'r', as NewBanksFromReplay would give them,
+// without building the banks: only the "BankFile" events of the game loop 0 are looked at.
+// ret[iPlayer] lists the names of the banks of the player of that index in ascending order, each once.
+func ListBankNames(r *repm.Rep) [][]string {
+	ret := make([][]string, len(r.InitData.LobbyState.Slots))
+	slots := slotIndexByUserID(r)
+	seen := map[int]map[string]bool{} // slot index => bank names listed
+	for _, evt := range r.GameEvts {
+		if evt.Loop() > 0 {
+			break
+		}
+		if evt.EvtType.Name != EvtTypeBankFile {
+			continue
+		}
+		iSlot, ok := slots[evt.UserID()]
+		if !ok {
+			continue
+		}
+		name := evt.Stringv("name")
+		if seen[iSlot] == nil {
+			seen[iSlot] = map[string]bool{}
+		}
+		if !seen[iSlot][name] {
+			seen[iSlot][name] = true
+			ret[iSlot] = append(ret[iSlot], name)
+		}
+	}
+	for _, names := range ret {
+		sort.Strings(names)
+	}
+	return ret
+}
+
+// BankCounts returns the number of banks of each player in 'banks', as returned by NewBanksFromReplay.
+// ret[iPlayer] is the number of banks of the player of the same index.
+func BankCounts(banks []map[string]*Bank) []int {
+	ret := make([]int, len(banks))
+	for iPlayer, playerBanks := range banks {
+		ret[iPlayer] = len(playerBanks)
+	}
+	return ret
+}
+
+// BankCountsByToon returns the number of banks of each player in 'banks' mapped from the toon handles of players.
+// Players without banks are left out as their toon handles are not known from banks.
+// Players of slots having no toon handle are keyed "Player<user ID>" as in NewBanksByToon.
+func BankCountsByToon(banks []map[string]*Bank) map[string]int {
+	ret := map[string]int{}
+	for _, playerBanks := range banks {
+		for _, bank := range playerBanks {
+			ret[toonKey(bank.UserSlot)] = len(playerBanks)
+			break
+		}
+	}
+	return ret
+}
+
+// BankLoad is a load of a bank in a replay.
+type BankLoad struct {
+	Loop     int64
+	Toon     string // toon handle of the loading user keyed as in NewBanksByToon, or "" if the user has no lobby slot
+	BankName string
+}
+
+// BankLoadOrder returns every "BankFile" event of the replay 'r' across all players, in replay order.
+// Slots of users are found by user ID as NewBanksFromReplay finds them.
+func BankLoadOrder(r *repm.Rep) []BankLoad {
+	slots := slotIndexByUserID(r)
+	var ret []BankLoad
+	for _, evt := range r.GameEvts {
+		if evt.EvtType.Name != EvtTypeBankFile {
+			continue
+		}
+		load := BankLoad{Loop: evt.Loop(), BankName: evt.Stringv("name")}
+		if iSlot, ok := slots[evt.UserID()]; ok {
+			load.Toon = toonKey(r.InitData.LobbyState.Slots[iSlot])
+		}
+		ret = append(ret, load)
+	}
+	return ret
+}
+
+// BankWriteStats are statistics of the bank events of a replay.
+type BankWriteStats struct {
+	Total     int   // number of bank events
+	PerPlayer []int // number of bank events of each player, indexed like NewBanksFromReplay
+	InGame    int   // number of bank events after loop 0, that is in-game saves
+}
+
+// NewBankWriteStats returns the statistics of the bank events of the replay 'r' in a single pass over its game events.
+// Events of users without a lobby slot count only in the total; slots are found by user ID as NewBanksFromReplay finds them.
+func NewBankWriteStats(r *repm.Rep) BankWriteStats {
+	slots := slotIndexByUserID(r)
+	ret := BankWriteStats{PerPlayer: make([]int, len(r.InitData.LobbyState.Slots))}
+	for _, evt := range r.GameEvts {
+		if !isBankEvent(evt) {
+			continue
+		}
+		ret.Total++
+		if iSlot, ok := slots[evt.UserID()]; ok {
+			ret.PerPlayer[iSlot]++
+		}
+		if evt.Loop() > 0 {
+			ret.InGame++
+		}
+	}
+	return ret
+}
+
+// TotalKeys returns the number of keys of all banks of all players in 'banks', as returned by NewBanksFromReplay,
+// the sum of KeyCount of every bank.
+func TotalKeys(banks []map[string]*Bank) int {
+	n := 0
+	for _, playerBanks := range banks {
+		for _, bank := range playerBanks {
+			n += bank.KeyCount()
+		}
+	}
+	return n
+}
+
+// CollectKeyValues returns the value of the key 'key' in the section 'section' of the bank named 'bankName'
+// of every player in 'banks', as returned by NewBanksFromReplay, mapped from the toon handles of players.
+// Players lacking the key are left out.
+// Players of slots having no toon handle are keyed "Player<user ID>" as in NewBanksByToon.
+func CollectKeyValues(banks []map[string]*Bank, bankName, section, key string) map[string]string {
+	ret := map[string]string{}
+	for _, playerBanks := range banks {
+		bank := playerBanks[bankName]
+		if bank == nil {
+			continue
+		}
+		if v, ok := bank.Lookup(section, key); ok {
+			ret[toonKey(bank.UserSlot)] = v.Data
+		}
+	}
+	return ret
+}
+
+// ProgressValues returns the value of the key 'key' in the section 'section' of the bank named 'bankName'
+// of every player in the replay 'r', mapped from the toon handles of players, as CollectKeyValues does.
+// Players lacking the key are left out. Banks are recovered once per rep, see CachedBanks,
+// so reading several keys of the same replay is cheap.
+// How the value tells progress, e.g. a percentage or a stage number, is up to the map.
+func ProgressValues(r *repm.Rep, bankName, section, key string) map[string]string {
+	return CollectKeyValues(CachedBanks(r), bankName, section, key)
+}
+
+// AnyPlayerHasKey returns the toon handles of the players in 'banks', as returned by NewBanksFromReplay,
+// whose bank named 'bankName' has the key 'key' in the section 'section', ordered by player index.
+// It returns nil if no player has the key.
+// Players of slots having no toon handle are keyed "Player<user ID>" as in NewBanksByToon.
+func AnyPlayerHasKey(banks []map[string]*Bank, bankName, section, key string) (toons []string) {
+	for _, playerBanks := range banks {
+		bank := playerBanks[bankName]
+		if bank == nil {
+			continue
+		}
+		if _, ok := bank.Lookup(section, key); ok {
+			toons = append(toons, toonKey(bank.UserSlot))
+		}
+	}
+	return toons
+}
+
+// ModifiedBanks returns the names of the banks each player of the replay 'r' modified during the game,
+// mapped from the toon handles of players. A bank is modified if it received "BankKey" or "BankValue" events
+// after loop 0, as opposed to banks only loaded at the start. Names are sorted.
+// Players having modified no bank are left out.
+// Players of slots having no toon handle are keyed "Player<user ID>" as in NewBanksByToon.
+func ModifiedBanks(r *repm.Rep) map[string][]string {
+	modified := map[int]map[string]bool{} // slot index => names of modified banks
+	scanBankEvents(r, func(iSlot int, bankName string, evt s2prot.Event) {
+		if evt.Loop() == 0 || bankName == "" {
+			return
+		}
+		if name := evt.EvtType.Name; name != EvtTypeBankKey && name != EvtTypeBankValue {
+			return
+		}
+		if modified[iSlot] == nil {
+			modified[iSlot] = map[string]bool{}
+		}
+		modified[iSlot][bankName] = true
+	})
+
+	ret := map[string][]string{}
+	for iSlot, names := range modified {
+		toon := toonKey(r.InitData.LobbyState.Slots[iSlot])
+		for name := range names {
+			ret[toon] = append(ret[toon], name)
+		}
+		sort.Strings(ret[toon])
+	}
+	return ret
+}
+
+// rosterToons returns the toon handles of the human participants of the replay 'r', sorted.
+// ok is false if any of them has no toon handle.
+func rosterToons(r *repm.Rep) (toons []string, ok bool) {
+	for _, slot := range r.InitData.LobbyState.Slots {
+		if slot.Control() != rep.ControlHuman || slot.Observe() != rep.ObserveParticipant {
+			continue
+		}
+		if slot.ToonHandle() == "" {
+			return nil, false
+		}
+		toons = append(toons, slot.ToonHandle())
+	}
+	sort.Strings(toons)
+	return toons, true
+}
+
+// SameRoster tells if the replays 'a' and 'b' were played by the same human players, regardless of their order.
+// Players are compared by their toon handles as in the lobby slots, requiring an exact match;
+// observers and computers are ignored.
+// Names are not compared: a roster having a player without a toon handle, e.g. of an anonymized replay,
+// is the same as no other.
+func SameRoster(a, b *repm.Rep) bool {
+	toonsA, okA := rosterToons(a)
+	toonsB, okB := rosterToons(b)
+	if !okA || !okB || len(toonsA) != len(toonsB) {
+		return false
+	}
+	for i := range toonsA {
+		if toonsA[i] != toonsB[i] {
+			return false
+		}
+	}
+	return true
+}
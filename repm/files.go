@@ -0,0 +1,182 @@
+/*
+
+Accessors of the sub-files of the MPQ of a replay.
+
+*/
+
+package repm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/icza/mpq"
+)
+
+// knownFiles are the names of the sub-files known to be found in replays.
+var knownFiles = []string{
+	"replay.details",
+	"replay.details.backup",
+	"replay.initData",
+	"replay.initData.backup",
+	"replay.attributes.events",
+	"replay.gamemetadata.json",
+	"replay.game.events",
+	"replay.message.events",
+	"replay.tracker.events",
+	"replay.sync.events",
+	"replay.sync.history",
+	"replay.smartcam.events",
+	"replay.load.info",
+	"replay.resumable.events",
+	"replay.server.battlelobby",
+}
+
+// UncompressedSize returns the total uncompressed size of the known sub-files of the replay.
+// Sizes of the sub-files read while decoding are reused, the rest are read from the MPQ.
+// Sub-files missing from the replay are skipped.
+func (r *Rep) UncompressedSize() (int64, error) {
+	var size int64
+	for _, name := range knownFiles {
+		h1, h2, h3 := mpq.FileNameHash(name)
+		if n, ok := r.fileSizes[[3]uint32{h1, h2, h3}]; ok {
+			size += n
+			continue
+		}
+		if r.m == nil {
+			continue
+		}
+		data, err := r.fileByHash(h1, h2, h3)
+		if err != nil {
+			return 0, err
+		}
+		size += int64(len(data))
+	}
+	return size, nil
+}
+
+// ListFiles returns the names of the sub-files of the replay as listed by the "(listfile)" of its MPQ,
+// including non-standard ones. Names are in listfile order.
+// An error is returned if the MPQ has no listfile, MPQ entries cannot be enumerated without it.
+func (r *Rep) ListFiles() ([]string, error) {
+	if r.m == nil {
+		return nil, errors.New("list files: MPQ is not available")
+	}
+	data, err := r.fileByHash(mpq.FileNameHash("(listfile)"))
+	if err != nil {
+		return nil, fmt.Errorf("list files: %v", err)
+	}
+	if data == nil {
+		return nil, errors.New("list files: MPQ has no (listfile)")
+	}
+	var names []string
+	for _, line := range strings.FieldsFunc(string(data), func(c rune) bool {
+		return c == '\r' || c == '\n' || c == ';'
+	}) {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// requiredFiles are the names of the sub-files the game writes into every replay.
+var requiredFiles = []string{
+	"replay.details",
+	"replay.initData",
+	"replay.attributes.events",
+	"replay.game.events",
+	"replay.message.events",
+}
+
+// baseBuildMetadata is the base build of 3.7, the first version writing "replay.gamemetadata.json".
+const baseBuildMetadata = 47185
+
+// LikelyEdited tells if the replay shows signs of having been edited or re-saved by a third-party tool.
+// It is a heuristic, reporting true if any of these holds:
+//   - the MPQ has no listfile, which the game always writes,
+//   - the listfile lacks a sub-file the game always writes, or lists one the game is not known to write,
+//   - game metadata is missing although the version should have it (3.7 or newer),
+//   - game or tracker events go on past the game loops recorded in the header.
+//
+// A false result does not prove the replay to be untouched.
+func (r *Rep) LikelyEdited() bool {
+	names, err := r.ListFiles()
+	if err != nil {
+		return true
+	}
+	listed := make(map[string]bool, len(names))
+	for _, name := range names {
+		listed[name] = true
+	}
+	for _, name := range requiredFiles {
+		if !listed[name] {
+			return true
+		}
+	}
+	known := make(map[string]bool, len(knownFiles))
+	for _, name := range knownFiles {
+		known[name] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			return true
+		}
+	}
+
+	if r.Header.BaseBuild() >= baseBuildMetadata && !r.HasMetadata {
+		return true
+	}
+
+	loops := r.Header.Loops()
+	if n := len(r.GameEvts); n > 0 && r.GameEvts[n-1].Loop() > loops {
+		return true
+	}
+	if r.TrackerEvts != nil {
+		if n := len(r.TrackerEvts.Evts); n > 0 && r.TrackerEvts.Evts[n-1].Loop() > loops {
+			return true
+		}
+	}
+	return false
+}
+
+// replayMarker is the text the header in the user data of replays starts with.
+var replayMarker = []byte("StarCraft II replay")
+
+// IsReplay tells if 'input' is the content of an SC2Replay file regardless of its name,
+// checking the MPQ magic, the user data holding the replay header, and the MPQ header it points to.
+// Nothing is decoded, so it is cheaper than New. 'input' is rewound to its start.
+// False and no error is returned for input that is not a replay, errors are of reading 'input'.
+func IsReplay(input io.ReadSeeker) (bool, error) {
+	if _, err := input.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	defer input.Seek(0, io.SeekStart)
+
+	// User data: magic, size, offset of the MPQ header, then the replay header
+	var userData [16 + 32]byte
+	if _, err := io.ReadFull(input, userData[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(userData[:4], mpqUserDataMagic[:]) || !bytes.Contains(userData[12:], replayMarker) {
+		return false, nil
+	}
+
+	headerOffset := int64(binary.LittleEndian.Uint32(userData[8:]))
+	if _, err := input.Seek(headerOffset, io.SeekStart); err != nil {
+		return false, err
+	}
+	var magic [4]byte
+	if _, err := io.ReadFull(input, magic[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return magic == mpqHeaderMagic, nil
+}
@@ -0,0 +1,134 @@
+package repm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/icza/mpq"
+	"github.com/icza/s2prot"
+)
+
+func TestIsReplay(t *testing.T) {
+	// replay returns replay-like content: user data of the replay header, then the MPQ header
+	replay := func(marker string, headerMagic []byte) []byte {
+		buf := &bytes.Buffer{}
+		buf.Write(mpqUserDataMagic[:])
+		binary.Write(buf, binary.LittleEndian, []uint32{64, 80})
+		buf.WriteString("\x00\x00\x00\x00\x05\x10\x00\x02\x2c" + marker)
+		buf.Write(make([]byte, 80-buf.Len()))
+		buf.Write(headerMagic)
+		return buf.Bytes()
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		exp  bool
+	}{
+		{"replay", replay("StarCraft II replay\x1b11", mpqHeaderMagic[:]), true},
+		{"other user data", replay("Heroes of the Storm replay", mpqHeaderMagic[:]), false},
+		{"no MPQ header", replay("StarCraft II replay\x1b11", []byte("MPQ")), false},
+		{"bare MPQ", testMPQ(0, mpqBlockIndexEmpty), false},
+		{"empty", nil, false},
+		{"text", []byte("not a replay at all, but long enough to be read as user data"), false},
+	}
+	for _, c := range cases {
+		input := bytes.NewReader(c.data)
+		got, err := IsReplay(input)
+		if err != nil {
+			t.Errorf("[%s] Unexpected error: %v", c.name, err)
+		}
+		if got != c.exp {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, c.exp, got)
+		}
+		if pos, _ := input.Seek(0, 1); pos != 0 {
+			t.Errorf("[%s] Expected input rewound, at: %v", c.name, pos)
+		}
+	}
+}
+
+func TestLikelyEdited(t *testing.T) {
+	if r := testFixtureRep(t); r.LikelyEdited() {
+		t.Errorf("Expected the fixture not to be edited")
+	}
+
+	m, err := newMPQ(bytes.NewReader(testMPQ(0, mpqBlockIndexEmpty)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if r := (&Rep{}); !r.LikelyEdited() {
+		t.Errorf("Expected edited without MPQ")
+	}
+	if r := (&Rep{m: m}); !r.LikelyEdited() {
+		t.Errorf("Expected edited without listfile")
+	}
+
+	cases := []struct {
+		name string
+		edit func(r *Rep)
+	}{
+		{"game events past the end", func(r *Rep) {
+			r.GameEvts = append(r.GameEvts, s2prot.Event{Struct: s2prot.Struct{"loop": r.Header.Loops() + 1}})
+		}},
+		{"tracker events past the end", func(r *Rep) {
+			r.TrackerEvts.Evts = append(r.TrackerEvts.Evts, s2prot.Event{Struct: s2prot.Struct{"loop": r.Header.Loops() + 1}})
+		}},
+		{"metadata missing", func(r *Rep) { r.Header.Structv("version")["baseBuild"] = int64(baseBuildMetadata) }},
+	}
+	for _, c := range cases {
+		r := testFixtureRep(t)
+		c.edit(r)
+		if !r.LikelyEdited() {
+			t.Errorf("[%s] Expected edited", c.name)
+		}
+	}
+}
+
+func TestUncompressedSize(t *testing.T) {
+	r := testFixtureRep(t)
+	var exp int64
+	for _, name := range knownFiles {
+		data, err := r.m.FileByHash(mpq.FileNameHash(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp += int64(len(data))
+	}
+	if got, err := r.UncompressedSize(); err != nil || got != exp || got == 0 {
+		t.Errorf("Expected: %v, got: %v (error: %v)", exp, got, err)
+	}
+
+	// Sizes recorded while decoding are reused without an MPQ
+	h1, h2, h3 := mpq.FileNameHash("replay.details")
+	r = &Rep{fileSizes: map[[3]uint32]int64{{h1, h2, h3}: 42}}
+	if got, err := r.UncompressedSize(); err != nil || got != 42 {
+		t.Errorf("Expected: %v, got: %v (error: %v)", 42, got, err)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	got, err := testFixtureRep(t).ListFiles()
+	exp := []string{
+		"replay.attributes.events", "replay.details", "replay.game.events", "replay.initData", "replay.load.info",
+		"replay.message.events", "replay.resumable.events", "replay.server.battlelobby", "replay.smartcam.events",
+		"replay.sync.events", "replay.tracker.events",
+	}
+	if err != nil || !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v (error: %v)", exp, got, err)
+	}
+
+	m, err := newMPQ(bytes.NewReader(testMPQ(0, mpqBlockIndexEmpty)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, err := (&Rep{m: m}).ListFiles(); err == nil {
+		t.Errorf("Expected an error without listfile")
+	}
+	if _, err := (&Rep{}).ListFiles(); err == nil {
+		t.Errorf("Expected an error without MPQ")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+
+Accessors describing the game played in a replay.
+
+*/
+
+package repm
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mapVersionRegexp matches a version the author encoded in a map title, e.g. "v2.3", "Ver 1.04" or "version 3".
+var mapVersionRegexp = regexp.MustCompile(`(?i)(?:^|[^a-z])v(?:er(?:sion)?)?\.?\s*(\d+(?:\.\d+)*)`)
+
+// MapVersion returns the version of the map the replay was played on.
+// The map version is not recorded as such, so it is read from where map authors encode it by convention:
+// the map title (Details.Title()), then the map description (Details.Description()),
+// e.g. "Tower Defense v2.3" gives "2.3".
+// ok is false if no version can be found.
+func (r *Rep) MapVersion() (version string, ok bool) {
+	for _, s := range []string{r.Details.Title(), r.Details.Description()} {
+		if m := mapVersionRegexp.FindStringSubmatch(s); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// ID returns an identifier of the game of the replay, the hex SHA-1 of the random value of the game,
+// the time the game started at, the checksum of the map, and the toon handles of players.
+// Replays of the same game recorded by different participants share the ID, replays of different games don't,
+// so it is suited to dedupe an archive. It is not the file hash: a replay re-saved by a tool keeps its ID.
+func (r *Rep) ID() string {
+	var toons []string
+	for _, p := range r.Details.Players() {
+		toons = append(toons, p.Toon.String())
+	}
+	sort.Strings(toons)
+	h := sha1.New()
+	fmt.Fprintf(h, "%d|%d|%d|%s", r.InitData.GameDescription.RandomValue(), r.Details.Int("timeUTC"),
+		r.InitData.GameDescription.MapFileSyncChecksum(), strings.Join(toons, ","))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// EffectiveDuration returns the in-game time elapsed until the last game or tracker event.
+// It is shorter than Header.Duration() if the replay goes on after the game, e.g. with observers lingering.
+// If neither game nor tracker events were decoded, Header.Duration() is returned.
+func (r *Rep) EffectiveDuration() time.Duration {
+	var loop int64 = -1
+	if n := len(r.GameEvts); n > 0 {
+		loop = r.GameEvts[n-1].Loop()
+	}
+	if r.TrackerEvts != nil {
+		if n := len(r.TrackerEvts.Evts); n > 0 && r.TrackerEvts.Evts[n-1].Loop() > loop {
+			loop = r.TrackerEvts.Evts[n-1].Loop()
+		}
+	}
+	if loop < 0 {
+		return r.Header.Duration()
+	}
+	return r.LoopToDuration(loop)
+}
+
+// GameEvtsErrLoop returns the game loop decoding game events failed at, the loop of the last event decoded
+// before the error, 0 if none was; ok is false if decoding game events had no errors.
+// Events of later loops are missing, and so may be the rest of those of the loop returned:
+// events of loop 0, e.g. bank events, are complete if the loop returned is past 0.
+func (r *Rep) GameEvtsErrLoop() (loop int64, ok bool) {
+	if !r.GameEvtsErr {
+		return 0, false
+	}
+	if n := len(r.GameEvts); n > 0 {
+		loop = r.GameEvts[n-1].Loop()
+	}
+	return loop, true
+}
+
+// CameraEvent is a camera movement of a user.
+type CameraEvent struct {
+	Loop   int64   // Game loop of the movement
+	UserID int64   // User moving the camera, or the player id in replays of old versions keying events by player
+	X, Y   float64 // Map coordinates of the new camera target
+}
+
+// CameraEvents returns the camera movements of users from the "CameraUpdate" game events, in game event order.
+// Camera events are decoded from "replay.game.events" in all versions, "replay.smartcam.events" is not read.
+// Updates not moving the camera target are skipped.
+// Returns nil if game events were not decoded.
+func (r *Rep) CameraEvents() []CameraEvent {
+	var ret []CameraEvent
+	for _, evt := range r.GameEvts {
+		if evt.EvtType.Name != "CameraUpdate" {
+			continue
+		}
+		target := evt.Structv("target")
+		if target == nil {
+			continue
+		}
+		ret = append(ret, CameraEvent{
+			Loop:   evt.Loop(),
+			UserID: eventUserID(evt),
+			X:      float64(target.Int("x")) / 256,
+			Y:      float64(target.Int("y")) / 256,
+		})
+	}
+	return ret
+}
@@ -0,0 +1,129 @@
+package repm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/icza/s2prot"
+	s2protrep "github.com/icza/s2prot/rep"
+)
+
+func TestMapVersion(t *testing.T) {
+	cases := []struct {
+		title   string
+		version string
+		ok      bool
+	}{
+		{"Tower Defense v2.3", "2.3", true},
+		{"Tower Defense V 1.04b", "1.04", true},
+		{"Squadron TD (Ver. 7)", "7", true},
+		{"RPG version 10.2.1", "10.2.1", true},
+		{"Overview", "", false},
+		{"Eternal Empire LE", "", false},
+		{"", "", false},
+	}
+
+	for _, c := range cases {
+		r := &Rep{Details: s2protrep.Details{Struct: s2prot.Struct{"title": c.title}}}
+		if version, ok := r.MapVersion(); version != c.version || ok != c.ok {
+			t.Errorf("Expected: %v %v, got: %v %v", c.version, c.ok, version, ok)
+		}
+	}
+}
+
+func TestEffectiveDuration(t *testing.T) {
+	evts := func(loops ...int64) []s2prot.Event {
+		var ret []s2prot.Event
+		for _, loop := range loops {
+			ret = append(ret, s2prot.Event{Struct: s2prot.Struct{"loop": loop}})
+		}
+		return ret
+	}
+	header := s2protrep.Header{Struct: s2prot.Struct{"elapsedGameLoops": int64(160)}}
+
+	cases := []struct {
+		name    string
+		r       *Rep
+		seconds int64
+	}{
+		{"game", &Rep{Header: header, GameEvts: evts(0, 32)}, 2},
+		{"tracker", &Rep{Header: header, GameEvts: evts(0, 32), TrackerEvts: &TrackerEvts{Evts: evts(0, 64)}}, 4},
+		{"none", &Rep{Header: header}, 10},
+	}
+	for _, c := range cases {
+		if got := c.r.EffectiveDuration(); got != time.Duration(c.seconds)*time.Second {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, time.Duration(c.seconds)*time.Second, got)
+		}
+	}
+}
+
+func TestGameEvtsErrLoop(t *testing.T) {
+	evts := []s2prot.Event{{Struct: s2prot.Struct{"loop": int64(0)}}, {Struct: s2prot.Struct{"loop": int64(32)}}}
+	cases := []struct {
+		name string
+		r    *Rep
+		loop int64
+		ok   bool
+	}{
+		{"no error", &Rep{GameEvts: evts}, 0, false},
+		{"past loop 0", &Rep{GameEvts: evts, GameEvtsErr: true}, 32, true},
+		{"at loop 0", &Rep{GameEvts: evts[:1], GameEvtsErr: true}, 0, true},
+		{"no events", &Rep{GameEvtsErr: true}, 0, true},
+	}
+	for _, c := range cases {
+		if loop, ok := c.r.GameEvtsErrLoop(); loop != c.loop || ok != c.ok {
+			t.Errorf("[%s] Expected: %v %v, got: %v %v", c.name, c.loop, c.ok, loop, ok)
+		}
+	}
+}
+
+func TestCameraEvents(t *testing.T) {
+	cameraUpdate := &s2prot.EvtType{Name: "CameraUpdate"}
+	r := &Rep{GameEvts: []s2prot.Event{
+		{EvtType: cameraUpdate, Struct: s2prot.Struct{"loop": int64(4), "userid": s2prot.Struct{"userId": int64(2)},
+			"target": s2prot.Struct{"x": int64(35328), "y": int64(512)}}},
+		{EvtType: &s2prot.EvtType{Name: "CmdEvent"}, Struct: s2prot.Struct{"loop": int64(5)}},
+		{EvtType: cameraUpdate, Struct: s2prot.Struct{"loop": int64(6), "userid": s2prot.Struct{"userId": int64(2)}, "target": nil}},
+		{EvtType: cameraUpdate, Struct: s2prot.Struct{"loop": int64(7), "userid": s2prot.Struct{"playerId": int64(1)},
+			"target": s2prot.Struct{"x": int64(256), "y": int64(128)}}},
+	}}
+
+	exp := []CameraEvent{{4, 2, 138, 2}, {7, 1, 1, 0.5}}
+	got := r.CameraEvents()
+	if len(got) != len(exp) {
+		t.Fatalf("Expected: %v, got: %v", exp, got)
+	}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("Expected: %v, got: %v", exp[i], got[i])
+		}
+	}
+}
+
+func TestID(t *testing.T) {
+	rep := func(randomValue int64, toons ...int64) *Rep {
+		var players []interface{}
+		for _, id := range toons {
+			players = append(players, s2prot.Struct{"toon": s2prot.Struct{"region": int64(1), "programId": "S2", "realm": int64(1), "id": id}})
+		}
+		return &Rep{
+			Details: s2protrep.Details{Struct: s2prot.Struct{"playerList": players, "timeUTC": int64(132000000000000000)}},
+			InitData: s2protrep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+				"gameDescription": s2prot.Struct{"randomValue": randomValue, "mapFileSyncChecksum": int64(7)},
+			}}),
+		}
+	}
+	id := rep(42, 1, 2).ID()
+	if len(id) != 40 {
+		t.Errorf("Expected a hex SHA-1, got: %v", id)
+	}
+	if got := rep(42, 2, 1).ID(); got != id {
+		t.Errorf("Expected: %v, got: %v", id, got)
+	}
+	if got := rep(43, 1, 2).ID(); got == id {
+		t.Errorf("Expected IDs of different games to differ, got: %v", got)
+	}
+	if got := rep(42, 1, 3).ID(); got == id {
+		t.Errorf("Expected IDs of different players to differ, got: %v", got)
+	}
+}
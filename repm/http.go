@@ -0,0 +1,172 @@
+/*
+
+Reading replays over HTTP.
+
+*/
+
+package repm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// httpChunkSize is the size of the chunks a replay is fetched in with range requests.
+// The MPQ is read in many small pieces at scattered offsets, fetching whole chunks saves most requests.
+const httpChunkSize = 64 << 10
+
+// httpReaderAt is an io.ReaderAt of a resource served over HTTP, read with range requests.
+// Chunks fetched are kept, so each is requested once.
+type httpReaderAt struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+
+	mu     sync.Mutex
+	chunks map[int64][]byte // chunks fetched, mapped from their indices
+	err    error            // first error of requests, which the MPQ reader would turn into ErrInvalidRepFile
+}
+
+// chunk returns the chunk of the index 'i', fetching it if not yet fetched.
+// The first error of requests is recorded.
+func (h *httpReaderAt) chunk(i int64) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if data, ok := h.chunks[i]; ok {
+		return data, nil
+	}
+	data, err := h.fetch(i)
+	if err != nil && h.err == nil {
+		h.err = err
+	}
+	return data, err
+}
+
+// fetch fetches the chunk of the index 'i' with a range request.
+// A server ignoring the range sends the whole resource, which is then kept split in all chunks.
+func (h *httpReaderAt) fetch(i int64) ([]byte, error) {
+	first := i * httpChunkSize
+	last := first + httpChunkSize - 1
+	if last >= h.size {
+		last = h.size - 1
+	}
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		whole, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("download replay: %v", err)
+		}
+		for j := int64(0); j*httpChunkSize < int64(len(whole)); j++ {
+			h.chunks[j] = whole[j*httpChunkSize : min((j+1)*httpChunkSize, int64(len(whole)))]
+		}
+		if data, ok := h.chunks[i]; ok && int64(len(data)) == last-first+1 {
+			return data, nil
+		}
+		return nil, fmt.Errorf("download replay: got %d bytes instead of %d", len(whole), h.size)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("range request: unexpected status: %s", resp.Status)
+	}
+	data := make([]byte, last-first+1)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, fmt.Errorf("range request: %v", err)
+	}
+	h.chunks[i] = data
+	return data, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (h *httpReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("range request: negative offset: %d", off)
+	}
+	for n < len(p) {
+		if off >= h.size {
+			return n, io.EOF
+		}
+		data, err := h.chunk(off / httpChunkSize)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], data[off%httpChunkSize:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// NewFromHTTP returns a new Rep of the replay served at 'url', read with HTTP range requests.
+// All types of events are decoded from the replay.
+// The returned Rep must be closed with the Close method!
+//
+// A HEAD request tells the size of the replay and if the server accepts ranges,
+// the replay is then read in chunks at the offsets the MPQ needs, sparing parts never read.
+// Servers not accepting ranges, or not telling the size, have the replay downloaded whole instead,
+// as do servers answering a range request with the whole replay.
+// 'ctx' governs all requests, including those of reading sub-files later on.
+//
+// Errors of requests and unexpected HTTP statuses are returned as they are, other errors are the same as those of New.
+func NewFromHTTP(ctx context.Context, url string) (*Rep, error) {
+	client := http.DefaultClient
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && resp.ContentLength > 0 && strings.Contains(resp.Header.Get("Accept-Ranges"), "bytes") {
+		h := &httpReaderAt{
+			ctx:    ctx,
+			client: client,
+			url:    url,
+			size:   resp.ContentLength,
+			chunks: map[int64][]byte{},
+		}
+		r, err := NewFromReaderAt(h, resp.ContentLength)
+		if err != nil {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if h.err != nil {
+				return nil, h.err
+			}
+		}
+		return r, err
+	}
+
+	// Full download
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download replay: unexpected status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("download replay: %v", err)
+	}
+	return New(bytes.NewReader(data))
+}
@@ -0,0 +1,148 @@
+package repm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testHTTPServer returns a server of 'data' at any path, accepting range requests if 'ranges' is true.
+// If 'acceptRanges' is true while 'ranges' is false, the server tells it accepts ranges but ignores them.
+// The number of GET requests served is counted in 'gets'.
+func testHTTPServer(data []byte, ranges, acceptRanges bool, gets *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			atomic.AddInt32(gets, 1)
+		}
+		if !ranges {
+			if acceptRanges {
+				w.Header().Set("Accept-Ranges", "bytes")
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			if req.Method == http.MethodGet { // ranges ignored
+				w.Write(data)
+			}
+			return
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func TestHTTPReaderAt(t *testing.T) {
+	data := make([]byte, 2*httpChunkSize+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	var gets int32
+	srv := testHTTPServer(data, true, true, &gets)
+	defer srv.Close()
+	h := &httpReaderAt{ctx: context.Background(), client: srv.Client(), url: srv.URL, size: int64(len(data)), chunks: map[int64][]byte{}}
+
+	cases := []struct {
+		off, n int64
+		eof    bool
+	}{
+		{0, 10, false},
+		{httpChunkSize - 5, 10, false}, // across chunks
+		{2*httpChunkSize + 90, 10, false},
+		{2*httpChunkSize + 95, 10, true}, // past the end
+		{0, int64(len(data)), false},
+	}
+	for i, c := range cases {
+		p := make([]byte, c.n)
+		n, err := h.ReadAt(p, c.off)
+		if c.eof != (err != nil) {
+			t.Errorf("[%d] Expected EOF: %v, got: %v", i, c.eof, err)
+		}
+		end := c.off + c.n
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		if !bytes.Equal(p[:n], data[c.off:end]) {
+			t.Errorf("[%d] Expected: %v bytes at %v, got: %v", i, end-c.off, c.off, n)
+		}
+	}
+	if gets != 3 {
+		t.Errorf("Expected: %v requests, got: %v", 3, gets)
+	}
+}
+
+func TestNewFromHTTP(t *testing.T) {
+	name := os.Getenv("SC2BANKRECOVER_BENCH_REPLAY")
+	if name == "" {
+		name = filepath.Join("testdata", "short-1v1.SC2Replay")
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Close()
+
+	cases := []struct {
+		name                 string
+		ranges, acceptRanges bool
+		gets                 int32 // GET requests expected, 0 for any
+	}{
+		{"ranges", true, true, 0},
+		{"no ranges", false, false, 1},
+		{"ranges ignored", false, true, 1},
+	}
+	for _, c := range cases {
+		var gets int32
+		srv := testHTTPServer(data, c.ranges, c.acceptRanges, &gets)
+		r, err := NewFromHTTP(context.Background(), srv.URL)
+		srv.Close()
+		if err != nil {
+			t.Errorf("[%s] Expected no error, got: %v", c.name, err)
+			continue
+		}
+		if r.Header.Loops() != exp.Header.Loops() || len(r.GameEvts) != len(exp.GameEvts) ||
+			r.Details.Title() != exp.Details.Title() {
+			t.Errorf("[%s] Expected the replay to be read as from a file", c.name)
+		}
+		if c.gets != 0 && gets != c.gets {
+			t.Errorf("[%s] Expected: %v GET requests, got: %v", c.name, c.gets, gets)
+		}
+		r.Close()
+	}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	if _, err := NewFromHTTP(context.Background(), srv.URL); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected an error of status 404, got: %v", err)
+	}
+	srv.Close()
+
+	// Failing range requests
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			return
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	if _, err := NewFromHTTP(context.Background(), srv.URL); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected an error of status 503, got: %v", err)
+	}
+	srv.Close()
+
+	// Transport errors
+	var urlErr *url.Error
+	if _, err := NewFromHTTP(context.Background(), srv.URL); !errors.As(err, &urlErr) {
+		t.Errorf("Expected a *url.Error, got: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+
+Accessors of the message events of a replay.
+
+*/
+
+package repm
+
+import (
+	"github.com/icza/s2prot"
+)
+
+// ChatMessage is a chat message sent by a user.
+type ChatMessage struct {
+	Loop      int64  // Game loop the message was sent at, 0 before the game started
+	UserID    int64  // User sending the message, or the player id in replays of old versions keying events by player
+	Recipient int64  // Recipient of the message: 0 all, 1 allies, 2 individual, 3 Battle.net, 4 observers
+	Text      string // Text of the message
+}
+
+// ChatMessages returns the chat messages from the "Chat" message events, in message event order.
+// Returns nil if message events were not decoded.
+func (r *Rep) ChatMessages() []ChatMessage {
+	var ret []ChatMessage
+	for _, evt := range r.MessageEvts {
+		if evt.EvtType.Name != "Chat" {
+			continue
+		}
+		ret = append(ret, ChatMessage{
+			Loop:      evt.Loop(),
+			UserID:    eventUserID(evt),
+			Recipient: evt.Int("recipient"),
+			Text:      evt.Stringv("string"),
+		})
+	}
+	return ret
+}
+
+// LobbyMessages returns the chat messages of ChatMessages sent before the game started, at loop 0.
+// Messages carry no lobby phase flag, so loop 0 is the only mark of them.
+// The game rarely records chat of the lobby, and nil is returned when it did not.
+func (r *Rep) LobbyMessages() []ChatMessage {
+	var ret []ChatMessage
+	for _, msg := range r.ChatMessages() {
+		if msg.Loop > 0 {
+			break
+		}
+		ret = append(ret, msg)
+	}
+	return ret
+}
+
+// eventUserID returns the user of the game or message event 'evt'.
+// Replays of old versions key events by player instead, the player id is returned for them.
+func eventUserID(evt s2prot.Event) int64 {
+	userID := evt.Structv("userid")
+	if id, ok := userID["userId"].(int64); ok {
+		return id
+	}
+	return userID.Int("playerId")
+}
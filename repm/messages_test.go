@@ -0,0 +1,34 @@
+package repm
+
+import (
+	"testing"
+
+	"github.com/icza/s2prot"
+)
+
+func TestLobbyMessages(t *testing.T) {
+	chat := &s2prot.EvtType{Name: "Chat"}
+	r := &Rep{MessageEvts: []s2prot.Event{
+		{EvtType: chat, Struct: s2prot.Struct{"loop": int64(0), "userid": s2prot.Struct{"userId": int64(1)}, "recipient": int64(0), "string": "glhf"}},
+		{EvtType: &s2prot.EvtType{Name: "LoadingProgress"}, Struct: s2prot.Struct{"loop": int64(0)}},
+		{EvtType: chat, Struct: s2prot.Struct{"loop": int64(160), "userid": s2prot.Struct{"playerId": int64(2)}, "recipient": int64(1), "string": "rush"}},
+	}}
+
+	exp := []ChatMessage{{0, 1, 0, "glhf"}, {160, 2, 1, "rush"}}
+	got := r.ChatMessages()
+	if len(got) != len(exp) {
+		t.Fatalf("Expected: %v, got: %v", exp, got)
+	}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("Expected: %v, got: %v", exp[i], got[i])
+		}
+	}
+
+	if got := r.LobbyMessages(); len(got) != 1 || got[0] != exp[0] {
+		t.Errorf("Expected: %v, got: %v", exp[:1], got)
+	}
+	if got := (&Rep{}).LobbyMessages(); got != nil {
+		t.Errorf("Expected: %v, got: %v", nil, got)
+	}
+}
@@ -0,0 +1,284 @@
+/*
+
+Sanity checks of the MPQ of a replay guarding the MPQ parser against crafted input.
+
+*/
+
+package repm
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/icza/mpq"
+)
+
+// maxSubFileSize is the largest uncompressed size of a sub-file accepted, far above that of any real replay.
+const maxSubFileSize = 256 << 20
+
+// errMPQInsane is returned by checkMPQ for input the MPQ parser must not be run on.
+var errMPQInsane = errors.New("MPQ fails sanity checks")
+
+// Magic bytes of the MPQ sections.
+var (
+	mpqUserDataMagic = [4]byte{'M', 'P', 'Q', 0x1b}
+	mpqHeaderMagic   = [4]byte{'M', 'P', 'Q', 0x1a}
+)
+
+// Block entry flags of the MPQ format.
+const (
+	mpqFlagFile       = 0x80000000
+	mpqFlagSingle     = 0x01000000
+	mpqFlagExtra      = 0x04000000
+	mpqFlagCompressed = 0x0000ff00
+	mpqFlagEncrypted  = 0x00010000
+)
+
+// Hash table entry block indices of the MPQ format.
+const (
+	mpqBlockIndexEmpty   = 0xffffffff // entry empty and always was, terminating lookups
+	mpqBlockIndexDeleted = 0xfffffffe // entry of a deleted file
+)
+
+// Decryption keys of the MPQ tables, the hashes of "(hash table)" and "(block table)".
+const (
+	mpqKeyHashTable  = 0xc3af3770
+	mpqKeyBlockTable = 0xec83b3a3
+)
+
+// mpqCryptTable is the number table of the MPQ decryption algorithm.
+var mpqCryptTable = func() (table [0x500]uint32) {
+	seed := uint32(0x00100001)
+	for index1 := 0; index1 < 0x100; index1++ {
+		for i, index2 := 0, index1; i < 5; i, index2 = i+1, index2+0x100 {
+			seed = (seed*125 + 3) % 0x2aaaab
+			temp := (seed & 0xffff) << 0x10
+			seed = (seed*125 + 3) % 0x2aaaab
+			table[index2] = temp | (seed & 0xffff)
+		}
+	}
+	return table
+}()
+
+// mpqDecrypt decrypts the table 'data' with 'key' in place.
+func mpqDecrypt(data []byte, key uint32) {
+	seed1, seed2 := key, uint32(0xeeeeeeee)
+	for i := 0; i+4 <= len(data); i += 4 {
+		seed2 += mpqCryptTable[0x400+(seed1&0xff)]
+		ch := binary.LittleEndian.Uint32(data[i:]) ^ (seed1 + seed2)
+		seed1 = ((^seed1 << 0x15) + 0x11111111) | (seed1 >> 0x0b)
+		seed2 = ch + seed2 + (seed2 << 5) + 3
+		binary.LittleEndian.PutUint32(data[i:], ch)
+	}
+}
+
+// checkMPQ checks that the MPQ read from 'input' can be handed to the mpq package.
+// The package trusts sizes and indices of the archive, so crafted input could make it allocate
+// arbitrary amounts of memory, index out of range, or probe the hash table forever.
+// checkMPQ requires tables and sub-files to lie within the input, sub-files to be of sane sizes,
+// indices to be in range, and the hash table to have an empty entry which lookups terminate at.
+// 'input' is rewound to its start.
+func checkMPQ(input io.ReadSeeker) error {
+	size, err := input.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := input.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	defer input.Seek(0, io.SeekStart)
+
+	// readAt reads the little-endian values 'data' at the offset 'off' of the input
+	readAt := func(off int64, data ...interface{}) error {
+		if off < 0 || off > size {
+			return errMPQInsane
+		}
+		if _, err := input.Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+		for _, d := range data {
+			if err := binary.Read(input, binary.LittleEndian, d); err != nil {
+				return errMPQInsane
+			}
+		}
+		return nil
+	}
+	// fits tells if 'n' bytes at the offset 'off' lie within the input
+	fits := func(off, n int64) bool {
+		return off >= 0 && n >= 0 && off <= size && n <= size-off
+	}
+
+	var magic [4]byte
+	if err := readAt(0, &magic); err != nil {
+		return err
+	}
+	var headerOffset int64
+	if magic == mpqUserDataMagic {
+		var userDataSize, userDataOffset uint32
+		if err := readAt(4, &userDataSize, &userDataOffset); err != nil {
+			return err
+		}
+		if !fits(12, int64(userDataSize)) {
+			return errMPQInsane
+		}
+		headerOffset = int64(userDataOffset)
+		if err := readAt(headerOffset, &magic); err != nil {
+			return err
+		}
+	}
+	if magic != mpqHeaderMagic {
+		return errMPQInsane
+	}
+
+	var h struct {
+		Size, ArchiveSize                   uint32
+		FormatVersion, SectorSizeShift      uint16
+		HashTableOffset, BlockTableOffset   uint32
+		HashTableEntries, BlockTableEntries uint32
+	}
+	var hashTableOffsetHigh, blockTableOffsetHigh uint16
+	if err := readAt(headerOffset+4, &h); err != nil {
+		return err
+	}
+	if h.FormatVersion > 0 {
+		var extendedBlockTableOffset uint64
+		if err := readAt(headerOffset+32, &extendedBlockTableOffset, &hashTableOffsetHigh, &blockTableOffsetHigh); err != nil {
+			return err
+		}
+	}
+	if h.SectorSizeShift > 20 { // sector size would overflow
+		return errMPQInsane
+	}
+	sectorSize := int64(512) << h.SectorSizeShift
+
+	// readTable reads and decrypts the table of 'entries' entries of 16 bytes at the archive offset 'off'
+	readTable := func(off int64, entries uint32, key uint32) ([]byte, error) {
+		off += headerOffset
+		if !fits(off, int64(entries)*16) {
+			return nil, errMPQInsane
+		}
+		data := make([]byte, int64(entries)*16)
+		if _, err := input.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(input, data); err != nil {
+			return nil, errMPQInsane
+		}
+		mpqDecrypt(data, key)
+		return data, nil
+	}
+
+	// Hash table: lookups start at a masked index and probe until an empty entry
+	if h.HashTableEntries == 0 || h.HashTableEntries&(h.HashTableEntries-1) != 0 {
+		return errMPQInsane
+	}
+	hashTable, err := readTable(int64(hashTableOffsetHigh)<<32+int64(h.HashTableOffset), h.HashTableEntries, mpqKeyHashTable)
+	if err != nil {
+		return err
+	}
+	hasEmpty := false
+	for i := 0; i < len(hashTable); i += 16 {
+		switch blockIndex := binary.LittleEndian.Uint32(hashTable[i+12:]); {
+		case blockIndex == mpqBlockIndexEmpty:
+			hasEmpty = true
+		case blockIndex == mpqBlockIndexDeleted:
+		case blockIndex >= h.BlockTableEntries:
+			return errMPQInsane
+		}
+	}
+	if !hasEmpty {
+		return errMPQInsane
+	}
+
+	// Block table: sub-files are read at their offsets and allocated at their sizes
+	blockTable, err := readTable(int64(blockTableOffsetHigh)<<32+int64(h.BlockTableOffset), h.BlockTableEntries, mpqKeyBlockTable)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(blockTable); i += 16 {
+		blockOffset := headerOffset + int64(binary.LittleEndian.Uint32(blockTable[i:]))
+		blockSize := int64(binary.LittleEndian.Uint32(blockTable[i+4:]))
+		fileSize := int64(binary.LittleEndian.Uint32(blockTable[i+8:]))
+		flags := binary.LittleEndian.Uint32(blockTable[i+12:])
+		if flags&mpqFlagFile == 0 {
+			continue
+		}
+		if fileSize > maxSubFileSize || !fits(blockOffset, blockSize) {
+			return errMPQInsane
+		}
+		if flags&mpqFlagCompressed == 0 {
+			if fileSize > blockSize { // sectors are read as stored
+				return errMPQInsane
+			}
+			continue
+		}
+		if flags&mpqFlagSingle != 0 || flags&mpqFlagEncrypted != 0 {
+			continue
+		}
+		// Sector offsets of compressed files must ascend within the block
+		sectors := (fileSize+sectorSize-1)/sectorSize + 1
+		if flags&mpqFlagExtra != 0 {
+			sectors++
+		}
+		if !fits(blockOffset, sectors*4) {
+			return errMPQInsane
+		}
+		offsets := make([]uint32, sectors)
+		if err := readAt(blockOffset, offsets); err != nil {
+			return err
+		}
+		for k := 1; k < len(offsets); k++ {
+			if offsets[k] < offsets[k-1] || int64(offsets[k]) > blockSize {
+				return errMPQInsane
+			}
+		}
+	}
+	return nil
+}
+
+// newMPQ returns a new MPQ parser of 'input' once it passes checkMPQ.
+// Panics of the parser are recovered.
+func newMPQ(input io.ReadSeeker) (m *mpq.MPQ, err error) {
+	if err := checkMPQ(input); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			m, err = nil, errMPQInsane
+		}
+	}()
+	return mpq.New(input)
+}
+
+// newMPQFromFile returns a new MPQ parser of the file 'name' once it passes checkMPQ.
+// Panics of the parser are recovered.
+func newMPQFromFile(name string) (m *mpq.MPQ, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	err = checkMPQ(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			m, err = nil, errMPQInsane
+		}
+	}()
+	return mpq.NewFromFile(name)
+}
+
+// fileByHash returns the sub-file of the hashes 'h1', 'h2' and 'h3' from the MPQ of the rep as mpq.MPQ.FileByHash does.
+// Panics of the parser are recovered.
+func (r *Rep) fileByHash(h1, h2, h3 uint32) (data []byte, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			data, err = nil, errMPQInsane
+		}
+	}()
+	return r.m.FileByHash(h1, h2, h3)
+}
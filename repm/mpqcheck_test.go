@@ -0,0 +1,128 @@
+package repm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/icza/mpq"
+)
+
+// testMPQEncrypt encrypts the table 'data' with 'key' in place, the inverse of mpqDecrypt.
+func testMPQEncrypt(data []byte, key uint32) {
+	seed1, seed2 := key, uint32(0xeeeeeeee)
+	for i := 0; i+4 <= len(data); i += 4 {
+		seed2 += mpqCryptTable[0x400+(seed1&0xff)]
+		ch := binary.LittleEndian.Uint32(data[i:])
+		binary.LittleEndian.PutUint32(data[i:], ch^(seed1+seed2))
+		seed1 = ((^seed1 << 0x15) + 0x11111111) | (seed1 >> 0x0b)
+		seed2 = ch + seed2 + (seed2 << 5) + 3
+	}
+}
+
+// testMPQ returns an MPQ archive having a hash table of the block indices 'blockIndices'
+// and a block table of a single uncompressed file of 4 bytes.
+func testMPQ(blockIndices ...uint32) []byte {
+	const headerSize = 32
+	hashTable := make([]byte, 16*len(blockIndices))
+	for i, blockIndex := range blockIndices {
+		binary.LittleEndian.PutUint32(hashTable[i*16+12:], blockIndex)
+	}
+	testMPQEncrypt(hashTable, mpqKeyHashTable)
+	blockTable := make([]byte, 16)
+	binary.LittleEndian.PutUint32(blockTable[0:], uint32(headerSize+len(hashTable)+len(blockTable)))
+	binary.LittleEndian.PutUint32(blockTable[4:], 4)
+	binary.LittleEndian.PutUint32(blockTable[8:], 4)
+	binary.LittleEndian.PutUint32(blockTable[12:], mpqFlagFile|mpqFlagSingle)
+	testMPQEncrypt(blockTable, mpqKeyBlockTable)
+
+	buf := &bytes.Buffer{}
+	buf.Write(mpqHeaderMagic[:])
+	binary.Write(buf, binary.LittleEndian, []uint32{headerSize, uint32(headerSize + len(hashTable) + len(blockTable) + 4)})
+	binary.Write(buf, binary.LittleEndian, []uint16{0, 3})
+	binary.Write(buf, binary.LittleEndian, []uint32{headerSize, uint32(headerSize + len(hashTable)), uint32(len(blockIndices)), 1})
+	buf.Write(hashTable)
+	buf.Write(blockTable)
+	buf.WriteString("data")
+	return buf.Bytes()
+}
+
+// testReplayMPQ returns an MPQ archive of the user data 'userData' and the uncompressed sub-files 'files'
+// mapped from their names, listed in a "(listfile)" in order of 'names'.
+func testReplayMPQ(userData []byte, names []string, files map[string][]byte) []byte {
+	const headerSize = 32
+	names = append(names, "(listfile)")
+	files["(listfile)"] = []byte(strings.Join(names[:len(names)-1], "\r\n"))
+
+	entries := uint32(1)
+	for entries < 2*uint32(len(names)) {
+		entries *= 2
+	}
+	hashTable := make([]byte, 16*entries)
+	for i := range entries {
+		binary.LittleEndian.PutUint32(hashTable[i*16+12:], mpqBlockIndexEmpty)
+	}
+	blockTable := make([]byte, 16*len(names))
+	offset := uint32(headerSize + len(hashTable) + len(blockTable))
+	for iBlock, name := range names {
+		h1, h2, h3 := mpq.FileNameHash(name)
+		i := h1 & (entries - 1)
+		for binary.LittleEndian.Uint32(hashTable[i*16+12:]) != mpqBlockIndexEmpty {
+			i = (i + 1) & (entries - 1)
+		}
+		binary.LittleEndian.PutUint32(hashTable[i*16:], h2)
+		binary.LittleEndian.PutUint32(hashTable[i*16+4:], h3)
+		binary.LittleEndian.PutUint32(hashTable[i*16+8:], 0)
+		binary.LittleEndian.PutUint32(hashTable[i*16+12:], uint32(iBlock))
+
+		size := uint32(len(files[name]))
+		binary.LittleEndian.PutUint32(blockTable[iBlock*16:], offset)
+		binary.LittleEndian.PutUint32(blockTable[iBlock*16+4:], size)
+		binary.LittleEndian.PutUint32(blockTable[iBlock*16+8:], size)
+		binary.LittleEndian.PutUint32(blockTable[iBlock*16+12:], mpqFlagFile|mpqFlagSingle)
+		offset += size
+	}
+	testMPQEncrypt(hashTable, mpqKeyHashTable)
+	testMPQEncrypt(blockTable, mpqKeyBlockTable)
+
+	buf := &bytes.Buffer{}
+	buf.Write(mpqUserDataMagic[:])
+	binary.Write(buf, binary.LittleEndian, []uint32{uint32(len(userData)), uint32(12 + len(userData))})
+	buf.Write(userData)
+	buf.Write(mpqHeaderMagic[:])
+	binary.Write(buf, binary.LittleEndian, []uint32{headerSize, offset})
+	binary.Write(buf, binary.LittleEndian, []uint16{0, 3})
+	binary.Write(buf, binary.LittleEndian, []uint32{headerSize, uint32(headerSize + len(hashTable)), entries, uint32(len(names))})
+	buf.Write(hashTable)
+	buf.Write(blockTable)
+	for _, name := range names {
+		buf.Write(files[name])
+	}
+	return buf.Bytes()
+}
+
+func TestCheckMPQ(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"valid", testMPQ(0, mpqBlockIndexEmpty), true},
+		{"full hash table", testMPQ(0, mpqBlockIndexDeleted), false},
+		{"block index out of range", testMPQ(1, mpqBlockIndexEmpty), false},
+		{"hash table size not a power of 2", testMPQ(0, mpqBlockIndexEmpty, mpqBlockIndexEmpty), false},
+		{"truncated", testMPQ(0, mpqBlockIndexEmpty)[:40], false},
+		{"not an MPQ", []byte("not an MPQ"), false},
+	}
+	for _, c := range cases {
+		if err := checkMPQ(bytes.NewReader(c.data)); (err == nil) != c.ok {
+			t.Errorf("[%s] Expected ok: %v, got: %v", c.name, c.ok, err)
+		}
+	}
+
+	// Looking up a missing file in a full hash table used to probe forever
+	if _, err := New(bytes.NewReader(testMPQ(0, mpqBlockIndexDeleted))); err == nil {
+		t.Errorf("Expected error for a full hash table")
+	}
+}
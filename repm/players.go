@@ -0,0 +1,158 @@
+/*
+
+Accessors classifying the participants of a replay.
+
+*/
+
+package repm
+
+import (
+	"strconv"
+
+	s2protrep "github.com/icza/s2prot/rep"
+)
+
+// IsSinglePlayer tells if the replay is of a single-player game,
+// that is a game of one human, optionally against computers.
+func (r *Rep) IsSinglePlayer() bool {
+	if r.InitData.LobbyState.IsSinglePlayer() {
+		return true
+	}
+	humans := 0
+	for _, slot := range r.InitData.LobbyState.Slots {
+		if slot.Control() == s2protrep.ControlHuman {
+			humans++
+		}
+	}
+	return humans == 1
+}
+
+// HumanPlayerCount returns the number of human players of the replay, the players who could have banks.
+// Lobby slots of the init data are counted if they are controlled by a human (not by a computer, AI that is,
+// and not open or closed) and observe as a participant (not as a spectator or a referee, observers that is).
+func (r *Rep) HumanPlayerCount() int {
+	n := 0
+	for _, slot := range r.InitData.LobbyState.Slots {
+		if slot.Control() == s2protrep.ControlHuman && slot.Observe() == s2protrep.ObserveParticipant {
+			n++
+		}
+	}
+	return n
+}
+
+// IsLadder1v1 tells if the replay is of a 1v1 ladder game:
+// 2 human players and no computers, matched by the automated matchmaking on a Blizzard map.
+// Observers don't count as players.
+//
+// Banks never appear in ladder games, so this is meant to be a fast predicate to skip replays.
+// It errs on the side of false negatives, which are safe: they just get processed.
+func (r *Rep) IsLadder1v1() bool {
+	if !r.Details.IsBlizzardMap() {
+		return false
+	}
+	if r.AttrEvts.GameMode() != s2protrep.GameModeAutoMM && !r.InitData.GameDescription.GameOptions.Amm() {
+		return false
+	}
+	humans := 0
+	for _, player := range r.Details.Players() {
+		switch player.Control() {
+		case s2protrep.ControlHuman:
+			if player.Observe() == s2protrep.ObserveParticipant {
+				humans++
+			}
+		case s2protrep.ControlComputer:
+			return false
+		}
+	}
+	return humans == 2
+}
+
+// slotByToon returns the index of the lobby slot of the toon handle 'toon' and the slot itself.
+// ok is false if no slot has the toon handle.
+func (r *Rep) slotByToon(toon string) (index int, slot s2protrep.Slot, ok bool) {
+	if toon == "" {
+		return 0, slot, false
+	}
+	for i, slot := range r.InitData.LobbyState.Slots {
+		if slot.ToonHandle() == toon {
+			return i, slot, true
+		}
+	}
+	return 0, slot, false
+}
+
+// isCoop tells if the replay is of a co-op commander game.
+func (r *Rep) isCoop() bool {
+	return r.InitData.GameDescription.IsCoopMode() || r.InitData.GameDescription.GameOptions.Cooperative()
+}
+
+// attrDifficulty is the attribute ID of the per-player difficulty in the attributes events.
+const attrDifficulty = "3004"
+
+// coopDifficulties are the co-op difficulty names mapped from the difficulty attribute values.
+var coopDifficulties = map[string]string{
+	"Easy": "Casual",
+	"Medi": "Normal",
+	"Hard": "Hard",
+	"VyHd": "Brutal",
+}
+
+// CoopDifficulty returns the co-op difficulty the player of the toon handle 'toon' played on,
+// e.g. "Casual", "Normal", "Hard" or "Brutal".
+// It is read from the difficulty attribute (ID 3004) of the attributes events in the scope of the player's slot;
+// values without a known co-op name are returned as they are.
+// ok is false for non-co-op games and for unknown toons.
+func (r *Rep) CoopDifficulty(toon string) (difficulty string, ok bool) {
+	if !r.isCoop() {
+		return "", false
+	}
+	index, _, ok := r.slotByToon(toon)
+	if !ok {
+		return "", false
+	}
+	// Player scopes are numbered from 1
+	value := r.AttrEvts.Stringv("scopes", strconv.Itoa(index+1), attrDifficulty, "value")
+	if value == "" {
+		return "", false
+	}
+	if name, known := coopDifficulties[value]; known {
+		return name, true
+	}
+	return value, true
+}
+
+// Commander returns the co-op commander the player of the toon handle 'toon' played, e.g. "Raynor".
+// It is read from the "commander" field of the player's lobby slot in the init data.
+// ok is false for non-co-op games, for unknown toons and if the slot has no commander.
+func (r *Rep) Commander(toon string) (commander string, ok bool) {
+	if !r.isCoop() {
+		return "", false
+	}
+	_, slot, ok := r.slotByToon(toon)
+	if !ok || slot.Commander() == "" {
+		return "", false
+	}
+	return slot.Commander(), true
+}
+
+// Recorder returns the player from whose perspective the replay was recorded.
+//
+// Replays don't record their recorder as such. It is only identifiable when there is a single
+// human player in the game (see IsSinglePlayer) and no observers, in which case it is that player.
+// ok is false otherwise, e.g. for multiplayer or observer-recorded replays.
+func (r *Rep) Recorder() (player s2protrep.Player, ok bool) {
+	if !r.IsSinglePlayer() {
+		return player, false
+	}
+	for _, slot := range r.InitData.LobbyState.Slots {
+		if slot.Control() == s2protrep.ControlHuman && slot.Observe() != s2protrep.ObserveParticipant {
+			return player, false
+		}
+	}
+	for _, p := range r.Details.Players() {
+		if p.Control() == s2protrep.ControlHuman {
+			return p, true
+		}
+	}
+	return player, false
+}
@@ -0,0 +1,156 @@
+package repm
+
+import (
+	"testing"
+
+	"github.com/icza/s2prot"
+	s2protrep "github.com/icza/s2prot/rep"
+)
+
+func TestHumanPlayerCount(t *testing.T) {
+	slot := func(control, observe int64) interface{} {
+		return s2prot.Struct{"control": control, "observe": observe}
+	}
+	r := &Rep{InitData: s2protrep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+		"lobbyState": s2prot.Struct{"slots": []interface{}{
+			slot(2, 0), // human player
+			slot(2, 0), // human player
+			slot(3, 0), // computer
+			slot(2, 1), // spectator
+			slot(2, 2), // referee
+			slot(0, 0), // open
+		}},
+	}})}
+	if got := r.HumanPlayerCount(); got != 2 {
+		t.Errorf("Expected: %v, got: %v", 2, got)
+	}
+	if got := (&Rep{}).HumanPlayerCount(); got != 0 {
+		t.Errorf("Expected: %v, got: %v", 0, got)
+	}
+}
+
+// testPlayersRep returns a replay of the lobby slots 'slots' and the players 'players' of the details.
+func testPlayersRep(slots, players []interface{}) *Rep {
+	return &Rep{
+		InitData: s2protrep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+			"lobbyState": s2prot.Struct{"slots": slots},
+		}}),
+		Details: s2protrep.Details{Struct: s2prot.Struct{"playerList": players}},
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	slot := func(control, observe int64) interface{} {
+		return s2prot.Struct{"control": control, "observe": observe}
+	}
+	player := func(name string, control int64) interface{} {
+		return s2prot.Struct{"name": name, "control": control}
+	}
+	cases := []struct {
+		name         string
+		slots        []interface{}
+		players      []interface{}
+		singlePlayer bool // lobby flagged single-player
+		exp          string
+		expOk        bool
+	}{
+		{"human vs computer", []interface{}{slot(2, 0), slot(3, 0)}, []interface{}{player("AI", 3), player("Zera", 2)}, false, "Zera", true},
+		{"human and observer", []interface{}{slot(2, 0), slot(2, 1)}, []interface{}{player("Zera", 2)}, false, "", false},
+		{"single-player and observer", []interface{}{slot(2, 0), slot(2, 1)}, []interface{}{player("Zera", 2)}, true, "", false},
+		{"two humans", []interface{}{slot(2, 0), slot(2, 0)}, []interface{}{player("Zera", 2), player("Raynor", 2)}, false, "", false},
+		{"no humans", []interface{}{slot(3, 0)}, []interface{}{player("AI", 3)}, false, "", false},
+	}
+	for _, c := range cases {
+		r := testPlayersRep(c.slots, c.players)
+		r.InitData.LobbyState.Struct["isSinglePlayer"] = c.singlePlayer
+		p, ok := r.Recorder()
+		if ok != c.expOk || p.Name != c.exp {
+			t.Errorf("[%s] Expected: %v, %v, got: %v, %v", c.name, c.exp, c.expOk, p.Name, ok)
+		}
+	}
+}
+
+func TestIsLadder1v1(t *testing.T) {
+	player := func(control, observe int64) interface{} {
+		return s2prot.Struct{"control": control, "observe": observe}
+	}
+	human, computer, observer := player(2, 0), player(3, 0), player(2, 1)
+	cases := []struct {
+		name     string
+		blizzard bool
+		mode     string // game mode attribute value
+		amm      bool   // automated matchmaking game option
+		players  []interface{}
+		exp      bool
+	}{
+		{"ladder 1v1", true, "Amm", false, []interface{}{human, human}, true},
+		{"ladder 1v1 by game option", true, "", true, []interface{}{human, human}, true},
+		{"ladder 1v1 and observer", true, "Amm", false, []interface{}{human, human, observer}, true},
+		{"ladder 1 human and observer", true, "Amm", false, []interface{}{human, observer}, false},
+		{"ladder vs computer", true, "Amm", false, []interface{}{human, computer}, false},
+		{"ladder 2v2", true, "Amm", false, []interface{}{human, human, human, human}, false},
+		{"private 1v1", true, "Priv", false, []interface{}{human, human}, false},
+		{"custom map 1v1", false, "Amm", false, []interface{}{human, human}, false},
+		{"no players", true, "Amm", false, nil, false},
+	}
+	for _, c := range cases {
+		r := testPlayersRep(nil, c.players)
+		r.Details.Struct["isBlizzardMap"] = c.blizzard
+		r.AttrEvts = s2protrep.NewAttrEvts(s2prot.Struct{"scopes": s2prot.Struct{"16": s2prot.Struct{"3009": s2prot.Struct{"value": c.mode}}}})
+		r.InitData = s2protrep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+			"gameDescription": s2prot.Struct{"gameOptions": s2prot.Struct{"amm": c.amm}},
+		}})
+		if got := r.IsLadder1v1(); got != c.exp {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, c.exp, got)
+		}
+	}
+}
+
+func TestCoop(t *testing.T) {
+	slot := func(toon, commander string) interface{} {
+		return s2prot.Struct{"toonHandle": toon, "commander": commander}
+	}
+	difficulty := func(value string) s2prot.Struct {
+		return s2prot.Struct{attrDifficulty: s2prot.Struct{"value": value}}
+	}
+	r := testPlayersRep([]interface{}{slot("1-S2-1-1", "Raynor"), slot("1-S2-1-2", "Kerrigan"), slot("1-S2-1-3", "")}, nil)
+	r.InitData = s2protrep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+		"lobbyState":      r.InitData.LobbyState.Struct,
+		"gameDescription": s2prot.Struct{"gameOptions": s2prot.Struct{"cooperative": true}},
+	}})
+	// Player scopes are the slot indices + 1
+	r.AttrEvts = s2protrep.NewAttrEvts(s2prot.Struct{"scopes": s2prot.Struct{
+		"1": difficulty("VyHd"),
+		"2": difficulty("Hard"),
+		"3": difficulty("Xtrm"),
+	}})
+
+	cases := []struct {
+		toon                      string
+		difficulty, commander     string
+		difficultyOk, commanderOk bool
+	}{
+		{"1-S2-1-1", "Brutal", "Raynor", true, true},
+		{"1-S2-1-2", "Hard", "Kerrigan", true, true},
+		{"1-S2-1-3", "Xtrm", "", true, false}, // unknown difficulty as is, no commander
+		{"1-S2-1-4", "", "", false, false},    // unknown toon
+		{"", "", "", false, false},
+	}
+	for _, c := range cases {
+		if got, ok := r.CoopDifficulty(c.toon); got != c.difficulty || ok != c.difficultyOk {
+			t.Errorf("[%s] Expected: %v, %v, got: %v, %v", c.toon, c.difficulty, c.difficultyOk, got, ok)
+		}
+		if got, ok := r.Commander(c.toon); got != c.commander || ok != c.commanderOk {
+			t.Errorf("[%s] Expected: %v, %v, got: %v, %v", c.toon, c.commander, c.commanderOk, got, ok)
+		}
+	}
+
+	// Not co-op
+	r.InitData.GameDescription.GameOptions.Struct["cooperative"] = false
+	if _, ok := r.CoopDifficulty("1-S2-1-1"); ok {
+		t.Errorf("Expected no difficulty of a non-co-op game")
+	}
+	if _, ok := r.Commander("1-S2-1-1"); ok {
+		t.Errorf("Expected no commander of a non-co-op game")
+	}
+}
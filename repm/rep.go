@@ -7,8 +7,14 @@ The Rep type that models a replay (and everything in it).
 package repm
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/icza/mpq"
 	"github.com/icza/s2prot"
@@ -19,6 +25,12 @@ import (
 type Rep struct {
 	m *mpq.MPQ // MPQ parser for reading the file
 
+	fileSizes map[[3]uint32]int64 // Sizes of the sub-files read while decoding, mapped from their name hashes
+
+	memo sync.Map // Values memoized with Memo, mapped from their keys
+
+	finalStats map[int64]s2prot.Struct // Last PlayerStats sample of players, mapped from their player IDs
+
 	protocol *s2prot.Protocol // Protocol to decode the replay
 
 	Header   s2protrep.Header   // Replay header (replay game version and length)
@@ -26,7 +38,8 @@ type Rep struct {
 	InitData s2protrep.InitData // Replay init data (the initial lobby)
 	AttrEvts s2protrep.AttrEvts // Attributes events
 
-	Metadata s2protrep.Metadata // Game metadata (calculated, confirmed results)
+	Metadata    s2protrep.Metadata // Game metadata (calculated, confirmed results)
+	HasMetadata bool               // Tells if game metadata was present, it is missing from replays before 3.7
 
 	GameEvts    []s2prot.Event // Game events
 	MessageEvts []s2prot.Event // Message events
@@ -35,6 +48,12 @@ type Rep struct {
 	GameEvtsErr    bool // Tells if decoding game events had errors
 	MessageEvtsErr bool // Tells if decoding message events had errors
 	TrackerEvtsErr bool // Tells if decoding tracker events had errors
+
+	GameEvtsErrVal    error // Error decoding game events had, see GameEvtsErrLoop for where
+	MessageEvtsErrVal error // Error decoding message events had
+	TrackerEvtsErrVal error // Error decoding tracker events had
+
+	ProtocolExact bool // Tells if the protocol of the replay's base build was used; false if the latest known one was used instead
 }
 
 // NewFromFile returns a new Rep constructed from a file.
@@ -61,11 +80,67 @@ func NewFromFile(name string) (*Rep, error) {
 //
 // ErrDecoding is returned if decoding the replay fails. This is most likely because the replay file is invalid, but also might be due to an implementation bug.
 func NewFromFileEvts(name string, game, message, tracker bool) (*Rep, error) {
-	m, err := mpq.NewFromFile(name)
+	m, err := newMPQFromFile(name)
 	if err != nil {
 		return nil, s2protrep.ErrInvalidRepFile
 	}
-	return newRep(m, game, message, tracker)
+	return newRep(context.Background(), m, game, message, tracker)
+}
+
+// NewFromFileContext returns a new Rep constructed from a file as NewFromFile does, decoding as long as 'ctx' is not done.
+// The context is checked before each part of the replay is decoded, the header, details, init data and each type of events;
+// once it is done, ctx.Err() is returned without decoding the rest. A part being decoded is not interrupted.
+// The returned Rep must be closed with the Close method!
+//
+// Other errors are the same as those of NewFromFile.
+func NewFromFileContext(ctx context.Context, name string) (*Rep, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m, err := newMPQFromFile(name)
+	if err != nil {
+		return nil, s2protrep.ErrInvalidRepFile
+	}
+	return newRep(ctx, m, true, true, true)
+}
+
+// NewFromFileBankEvts returns a new Rep constructed from a file for bank recovery:
+// game events are decoded, but only the bank events of the game loop 0 are kept, banks are loaded at.
+// Message and tracker events are not decoded.
+// Replay header, init data, details, attributes events and game metadata are decoded as by NewFromFileEvts.
+// The returned Rep must be closed with the Close method!
+//
+// s2prot decodes game events as a whole, so they are all decoded nonetheless;
+// the time saved is that of message and tracker events, and the memory that of game events dropped.
+// Banks recovered are the same, but bank events of later loops are missing, e.g. of keys written in-game.
+//
+// Errors are the same as those of NewFromFile.
+func NewFromFileBankEvts(name string) (*Rep, error) {
+	r, err := NewFromFileEvts(name, true, false, false)
+	if err != nil {
+		return nil, err
+	}
+	r.GameEvts = bankEvts(r.GameEvts)
+	return r, nil
+}
+
+// bankEvtTypeNames are the names of the types of game events of banks.
+var bankEvtTypeNames = map[string]bool{
+	"BankFile": true, "BankSection": true, "BankKey": true, "BankValue": true, "BankSignature": true,
+}
+
+// bankEvts returns the bank events of the game loop 0 of the game events 'evts', in a new slice so the rest can be freed.
+func bankEvts(evts []s2prot.Event) []s2prot.Event {
+	var ret []s2prot.Event
+	for _, evt := range evts {
+		if evt.Loop() > 0 {
+			break
+		}
+		if bankEvtTypeNames[evt.EvtType.Name] {
+			ret = append(ret, evt)
+		}
+	}
+	return ret
 }
 
 // New returns a new Rep using the specified io.ReadSeeker as the SC2Replay file source.
@@ -92,15 +167,76 @@ func New(input io.ReadSeeker) (*Rep, error) {
 //
 // ErrDecoding is returned if decoding the replay fails. This is most likely because the input is invalid, but also might be due to an implementation bug.
 func NewEvts(input io.ReadSeeker, game, message, tracker bool) (*Rep, error) {
-	m, err := mpq.New(input)
+	m, err := newMPQ(input)
 	if err != nil {
 		return nil, s2protrep.ErrInvalidRepFile
 	}
-	return newRep(m, game, message, tracker)
+	return newRep(context.Background(), m, game, message, tracker)
+}
+
+// NewFromBytes returns a new Rep of the SC2Replay file content 'data', only the specified types of events decoded.
+// It is NewEvts reading 'data' through a bytes.Reader, with the same errors.
+// The returned Rep must be closed with the Close method!
+func NewFromBytes(data []byte, game, message, tracker bool) (*Rep, error) {
+	return NewEvts(bytes.NewReader(data), game, message, tracker)
+}
+
+// ReadDetails decodes only the header and the details of the replay file 'name'.
+// It is faster than NewFromFileEvts(name, false, false, false), which still decodes
+// init data, attributes events and game metadata.
+//
+// Errors are the same as those of NewFromFile.
+func ReadDetails(name string) (header s2protrep.Header, details s2protrep.Details, errRes error) {
+	m, err := newMPQFromFile(name)
+	if err != nil {
+		return header, details, s2protrep.ErrInvalidRepFile
+	}
+	defer m.Close()
+	defer func() {
+		// Protect replay decoding:
+		if r := recover(); r != nil {
+			errRes = s2protrep.ErrDecoding
+		}
+	}()
+
+	if ud := m.UserData(); len(ud) < 4 || !versionedSane(ud[4:]) {
+		return header, details, s2protrep.ErrInvalidRepFile
+	}
+	header = s2protrep.Header{Struct: s2prot.DecodeHeader(m.UserData())}
+	if header.Struct == nil {
+		return header, details, s2protrep.ErrInvalidRepFile
+	}
+	p, _ := protocolOf(header)
+	if p == nil {
+		return header, details, s2protrep.ErrUnsupportedRepVersion
+	}
+	details, err = decodeDetails(p, m.FileByHash)
+	return header, details, err
+}
+
+// NewFromReaderAt returns a new Rep using the specified io.ReaderAt of 'size' bytes as the SC2Replay file source.
+// All types of events are decoded from the replay.
+// The returned Rep must be closed with the Close method!
+//
+// The input is wrapped in an io.SectionReader, so it is read at the offsets the MPQ needs.
+// Errors are the same as those of New.
+func NewFromReaderAt(input io.ReaderAt, size int64) (*Rep, error) {
+	return NewFromReaderAtEvts(input, size, true, true, true)
+}
+
+// NewFromReaderAtEvts returns a new Rep using the specified io.ReaderAt of 'size' bytes as the SC2Replay file source,
+// only the specified types of events decoded.
+// The game, message and tracker tells if game events, message events and tracker events are to be decoded.
+// The returned Rep must be closed with the Close method!
+//
+// Errors are the same as those of NewEvts.
+func NewFromReaderAtEvts(input io.ReaderAt, size int64, game, message, tracker bool) (*Rep, error) {
+	return NewEvts(io.NewSectionReader(input, 0, size), game, message, tracker)
 }
 
 // newRep returns a new Rep constructed using the specified mpq.MPQ handler of the SC2Replay file, only the specified types of events decoded.
 // The game, message and tracker tells if game events, message events and tracker events are to be decoded.
+// ctx.Err() is returned if 'ctx' is done before a part of the replay is decoded.
 // Replay header, init data, details, attributes events and game metadata are always decoded.
 // The returned Rep must be closed with the Close method!
 //
@@ -109,7 +245,7 @@ func NewEvts(input io.ReadSeeker, game, message, tracker bool) (*Rep, error) {
 // ErrUnsupportedRepVersion is returned if the input is a valid SC2Replay file but its version is not supported.
 //
 // ErrDecoding is returned if decoding the replay fails. This is most likely because the input is invalid, but also might be due to an implementation bug.
-func newRep(m *mpq.MPQ, game, message, tracker bool) (parsedRep *Rep, errRes error) {
+func newRep(ctx context.Context, m *mpq.MPQ, game, message, tracker bool) (parsedRep *Rep, errRes error) {
 	closeMPQ := true
 	defer func() {
 		// If returning due to an error, MPQ must be closed!
@@ -124,52 +260,60 @@ func newRep(m *mpq.MPQ, game, message, tracker bool) (parsedRep *Rep, errRes err
 		}
 	}()
 
-	rep := Rep{m: m}
+	rep := Rep{m: m, fileSizes: map[[3]uint32]int64{}}
 
+	// readFile reads a sub-file of the MPQ recording its size.
+	readFile := func(h1, h2, h3 uint32) ([]byte, error) {
+		data, err := m.FileByHash(h1, h2, h3)
+		if err == nil && data != nil {
+			rep.fileSizes[[3]uint32{h1, h2, h3}] = int64(len(data))
+		}
+		return data, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// The header follows 4 bytes of the MPQ user data, see s2prot.DecodeHeader
+	if ud := m.UserData(); len(ud) < 4 || !versionedSane(ud[4:]) {
+		return nil, s2protrep.ErrInvalidRepFile
+	}
 	rep.Header = s2protrep.Header{Struct: s2prot.DecodeHeader(m.UserData())}
 	if rep.Header.Struct == nil {
 		return nil, s2protrep.ErrInvalidRepFile
 	}
 
-	bb := rep.Header.BaseBuild()
-	p := s2prot.GetProtocol(int(bb))
-	// What's modified from what's written by icza.
-	if p == nil {
-		p = s2prot.GetProtocol(s2prot.MaxBaseBuild)
-	}
-	// What's modified from what's written by icza.
+	p, exact := protocolOf(rep.Header)
 	if p == nil {
 		return nil, s2protrep.ErrUnsupportedRepVersion
 	}
 	rep.protocol = p
+	rep.ProtocolExact = exact
 
-	data, err := m.FileByHash(620083690, 3548627612, 4013960850) // "replay.details"
-	if err != nil || len(data) == 0 {
-		// Attempt to open the anonymized version
-		data, err = m.FileByHash(1421087648, 3590964654, 3400061273) // "replay.details.backup"
-		if err != nil || len(data) == 0 {
-			return nil, s2protrep.ErrInvalidRepFile
-		}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// The primary sub-files of details and init data may hold implausible data
+	// (see plausibleDetails and plausibleInitData), in which case the backups are used.
+	var err error
+	if rep.Details, err = decodeDetails(p, readFile); err != nil {
+		return nil, err
 	}
-	rep.Details = s2protrep.Details{Struct: p.DecodeDetails(data)}
 
-	data, err = m.FileByHash(3544165653, 1518242780, 4280631132) // "replay.initData"
-	if err != nil || len(data) == 0 {
-		// Attempt to open the anonymized version
-		data, err = m.FileByHash(868899905, 1282002788, 1614930827) // "replay.initData.backup"
-		if err != nil || len(data) == 0 {
-			return nil, s2protrep.ErrInvalidRepFile
-		}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if rep.InitData, err = decodeInitData(p, readFile); err != nil {
+		return nil, err
 	}
-	rep.InitData = s2protrep.NewInitData(p.DecodeInitData(data))
 
-	data, err = m.FileByHash(1306016990, 497594575, 2731474728) // "replay.attributes.events"
+	data, err := readFile(1306016990, 497594575, 2731474728) // "replay.attributes.events"
 	if err != nil {
 		return nil, s2protrep.ErrInvalidRepFile
 	}
 	rep.AttrEvts = s2protrep.NewAttrEvts(p.DecodeAttributesEvts(data))
 
-	data, err = m.FileByHash(3675439372, 3912155403, 1108615308) // "replay.gamemetadata.json"
+	data, err = readFile(3675439372, 3912155403, 1108615308) // "replay.gamemetadata.json"
 	if err != nil {
 		return nil, s2protrep.ErrInvalidRepFile
 	}
@@ -177,35 +321,46 @@ func newRep(m *mpq.MPQ, game, message, tracker bool) (parsedRep *Rep, errRes err
 		if err = json.Unmarshal(data, &rep.Metadata.Struct); err != nil {
 			return nil, s2protrep.ErrInvalidRepFile
 		}
+		rep.HasMetadata = true
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if game {
-		data, err = m.FileByHash(496563520, 2864883019, 4101385109) // "replay.game.events"
+		data, err = readFile(496563520, 2864883019, 4101385109) // "replay.game.events"
 		if err != nil {
 			return nil, s2protrep.ErrInvalidRepFile
 		}
-		rep.GameEvts, err = p.DecodeGameEvts(data)
-		rep.GameEvtsErr = err != nil
+		rep.GameEvts, rep.GameEvtsErrVal = p.DecodeGameEvts(data)
+		rep.GameEvtsErr = rep.GameEvtsErrVal != nil
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if message {
-		data, err = m.FileByHash(1089231967, 831857289, 1784674979) // "replay.message.events"
+		data, err = readFile(1089231967, 831857289, 1784674979) // "replay.message.events"
 		if err != nil {
 			return nil, s2protrep.ErrInvalidRepFile
 		}
-		rep.MessageEvts, err = p.DecodeMessageEvts(data)
-		rep.MessageEvtsErr = err != nil
+		rep.MessageEvts, rep.MessageEvtsErrVal = p.DecodeMessageEvts(data)
+		rep.MessageEvtsErr = rep.MessageEvtsErrVal != nil
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if tracker {
-		data, err = m.FileByHash(1501940595, 4263103390, 1648390237) // "replay.tracker.events"
+		data, err = readFile(1501940595, 4263103390, 1648390237) // "replay.tracker.events"
 		if err != nil {
 			return nil, s2protrep.ErrInvalidRepFile
 		}
-		evts, err := p.DecodeTrackerEvts(data)
+		evts, err := decodeTrackerEvts(p, data)
 		rep.TrackerEvts = &TrackerEvts{Evts: evts}
 		rep.TrackerEvts.init(&rep)
 		rep.TrackerEvtsErr = err != nil
+		rep.TrackerEvtsErrVal = err
 	}
 
 	// Everything went well, Rep is about to be returned, do not close MPQ
@@ -215,6 +370,112 @@ func newRep(m *mpq.MPQ, game, message, tracker bool) (parsedRep *Rep, errRes err
 	return &rep, nil
 }
 
+// protocolOf returns the protocol to decode the replay of the header 'h' with, or nil if there is none.
+// exact tells if the protocol is of the base build of the replay;
+// otherwise it is the protocol of the latest known base build, used on a best-effort basis.
+func protocolOf(h s2protrep.Header) (p *s2prot.Protocol, exact bool) {
+	bb := h.BaseBuild()
+	p = s2prot.GetProtocol(int(bb))
+	exact = p != nil
+	// What's modified from what's written by icza.
+	if p == nil {
+		p = s2prot.GetProtocol(s2prot.MaxBaseBuild)
+	}
+	// What's modified from what's written by icza.
+	return p, exact
+}
+
+// decodeTrackerEvts decodes the tracker events sub-file 'data' with the protocol 'p'.
+// Only the events up to the first insane instance (see versionedPrefix) are decoded,
+// a cut stream is reported by an error along with the events before the cut.
+func decodeTrackerEvts(p *s2prot.Protocol, data []byte) ([]s2prot.Event, error) {
+	n := versionedPrefix(data)
+	evts, err := p.DecodeTrackerEvts(data[:n])
+	if n < len(data) {
+		err = errors.Join(err, fmt.Errorf("tracker events cut short at offset %d of %d by an insane instance", n, len(data)))
+	}
+	return evts, err
+}
+
+// decodeDetails decodes the details of a replay with the protocol 'p', reading sub-files with 'readFile'.
+// Falls back to the anonymized version if the primary is missing or implausible.
+func decodeDetails(p *s2prot.Protocol, readFile func(h1, h2, h3 uint32) ([]byte, error)) (d s2protrep.Details, err error) {
+	var ok bool
+	data, err := readFile(620083690, 3548627612, 4013960850) // "replay.details"
+	if err == nil && len(data) > 0 {
+		d, ok = plausibleDetails(p, data)
+	}
+	if !ok {
+		// Attempt to open the anonymized version
+		if backup, err := readFile(1421087648, 3590964654, 3400061273); err == nil && len(backup) > 0 { // "replay.details.backup"
+			if !versionedSane(backup) {
+				return d, s2protrep.ErrInvalidRepFile
+			}
+			d = s2protrep.Details{Struct: p.DecodeDetails(backup)}
+		} else if len(data) > 0 {
+			if !versionedSane(data) {
+				return d, s2protrep.ErrInvalidRepFile
+			}
+			// No backup to fall back to, stick to the primary
+			d = s2protrep.Details{Struct: p.DecodeDetails(data)}
+		} else {
+			return d, s2protrep.ErrInvalidRepFile
+		}
+	}
+	return d, nil
+}
+
+// decodeInitData decodes the init data of a replay with the protocol 'p', reading sub-files with 'readFile'.
+// Falls back to the anonymized version if the primary is missing or implausible.
+func decodeInitData(p *s2prot.Protocol, readFile func(h1, h2, h3 uint32) ([]byte, error)) (i s2protrep.InitData, err error) {
+	var ok bool
+	data, err := readFile(3544165653, 1518242780, 4280631132) // "replay.initData"
+	if err == nil && len(data) > 0 {
+		i, ok = plausibleInitData(p, data)
+	}
+	if !ok {
+		// Attempt to open the anonymized version
+		if backup, err := readFile(868899905, 1282002788, 1614930827); err == nil && len(backup) > 0 { // "replay.initData.backup"
+			i = s2protrep.NewInitData(p.DecodeInitData(backup))
+		} else if len(data) > 0 {
+			// No backup to fall back to, stick to the primary
+			i = s2protrep.NewInitData(p.DecodeInitData(data))
+		} else {
+			return i, s2protrep.ErrInvalidRepFile
+		}
+	}
+	return i, nil
+}
+
+// plausibleDetails decodes the details sub-file 'data' and tells if the result is plausible.
+// Details are plausible if decoding succeeds and gives at least 1 player;
+// a tiny garbage blob of a corrupted replay may still decode, but to an empty player list.
+// Data having insane lengths (see versionedSane) is not decoded at all.
+func plausibleDetails(p *s2prot.Protocol, data []byte) (d s2protrep.Details, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+	if !versionedSane(data) {
+		return d, false
+	}
+	d = s2protrep.Details{Struct: p.DecodeDetails(data)}
+	return d, len(d.Players()) > 0
+}
+
+// plausibleInitData decodes the init data sub-file 'data' and tells if the result is plausible.
+// Init data is plausible if decoding succeeds and gives at least 1 lobby slot.
+func plausibleInitData(p *s2prot.Protocol, data []byte) (i s2protrep.InitData, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+	i = s2protrep.NewInitData(p.DecodeInitData(data))
+	return i, len(i.LobbyState.Slots) > 0
+}
+
 // Close closes the Rep and its resources.
 func (r *Rep) Close() error {
 	if r.m == nil {
@@ -223,8 +484,32 @@ func (r *Rep) Close() error {
 	return r.m.Close()
 }
 
+// LoopToDuration converts the game loop 'loop' to the in-game time elapsed by then.
+func (r *Rep) LoopToDuration(loop int64) time.Duration {
+	// 1 second = 16 loops => 1 loop = 1/16 second = 62,500,000 ns
+	return time.Duration(loop * 62500000)
+}
+
 // MPQ gives access to the underlying MPQ parser of the rep.
 // Intentionally not a method of Rep to not urge its use.
 func MPQ(r *Rep) *mpq.MPQ {
 	return r.m
 }
+
+// memoEntry is a value memoized on a Rep.
+type memoEntry struct {
+	once  sync.Once
+	value interface{}
+}
+
+// Memo returns the value memoized on the rep under 'key', computing it with 'fn' on the first call.
+// Concurrent callers of the same key wait for the first computation to finish.
+// Intentionally not a method of Rep, it is a hook for packages building on top of it.
+func Memo(r *Rep, key interface{}, fn func() interface{}) interface{} {
+	v, _ := r.memo.LoadOrStore(key, &memoEntry{})
+	e := v.(*memoEntry)
+	e.once.Do(func() {
+		e.value = fn()
+	})
+	return e.value
+}
@@ -0,0 +1,402 @@
+package repm
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/icza/s2prot"
+	s2protrep "github.com/icza/s2prot/rep"
+)
+
+// benchReplay returns the name of the replay file to benchmark with,
+// given by the SC2BANKRECOVER_BENCH_REPLAY environment variable.
+// Skips the benchmark if it is not set.
+func benchReplay(b *testing.B) string {
+	name := os.Getenv("SC2BANKRECOVER_BENCH_REPLAY")
+	if name == "" {
+		b.Skip("SC2BANKRECOVER_BENCH_REPLAY is not set")
+	}
+	return name
+}
+
+// testFixtureRep returns the replay of the fixture "testdata/short-1v1.SC2Replay", closed when the test ends.
+func testFixtureRep(t *testing.T) *Rep {
+	t.Helper()
+	r, err := NewFromFile(filepath.Join("testdata", "short-1v1.SC2Replay"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestHasMetadata(t *testing.T) {
+	r := testFixtureRep(t)
+	if r.HasMetadata {
+		t.Errorf("Expected no metadata of a replay before 3.7")
+	}
+
+	// The fixture rebuilt with game metadata
+	names, err := r.ListFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, name := range names {
+		if files[name], err = r.m.FileByName(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names = append(names, "replay.gamemetadata.json")
+	files["replay.gamemetadata.json"] = []byte(`{"Title":"Fixture","GameVersion":"2.1.9.32283"}`)
+	got, err := New(bytes.NewReader(testReplayMPQ(r.m.UserData(), names, files)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if !got.HasMetadata || got.Metadata.Title() != "Fixture" {
+		t.Errorf("Expected metadata, got: %v (HasMetadata: %v)", got.Metadata, got.HasMetadata)
+	}
+	if len(got.GameEvts) != len(r.GameEvts) {
+		t.Errorf("Expected: %v game events, got: %v", len(r.GameEvts), len(got.GameEvts))
+	}
+}
+
+func TestMemo(t *testing.T) {
+	r := &Rep{}
+	calls := 0
+	fn := func() interface{} {
+		calls++
+		return calls
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := Memo(r, "key", fn); got != 1 {
+				t.Errorf("Expected: %v, got: %v", 1, got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected: %v calls, got: %v", 1, calls)
+	}
+	if got := Memo(r, "other", fn); got != 2 {
+		t.Errorf("Expected: %v, got: %v", 2, got)
+	}
+}
+
+func BenchmarkReadDetails(b *testing.B) {
+	name := benchReplay(b)
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ReadDetails(name); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewFromFileEvtsNone(b *testing.B) {
+	name := benchReplay(b)
+	for i := 0; i < b.N; i++ {
+		r, err := NewFromFileEvts(name, false, false, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		r.Close()
+	}
+}
+
+func BenchmarkNewFromFile(b *testing.B) {
+	name := benchReplay(b)
+	for i := 0; i < b.N; i++ {
+		r, err := NewFromFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		r.Close()
+	}
+}
+
+func BenchmarkNewFromFileBankEvts(b *testing.B) {
+	name := benchReplay(b)
+	for i := 0; i < b.N; i++ {
+		r, err := NewFromFileBankEvts(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		r.Close()
+	}
+}
+
+// testCountdownCtx is a context done after its Err method is called 'n' times.
+type testCountdownCtx struct {
+	context.Context
+	n int
+}
+
+func (c *testCountdownCtx) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestNewFromFileContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewFromFileContext(ctx, "missing.SC2Replay"); err != context.Canceled {
+		t.Errorf("Expected: %v, got: %v", context.Canceled, err)
+	}
+
+	name := os.Getenv("SC2BANKRECOVER_BENCH_REPLAY")
+	if name == "" {
+		name = filepath.Join(t.TempDir(), "test.SC2Replay")
+		if err := os.WriteFile(name, testMPQ(0, mpqBlockIndexEmpty), 0644); err != nil { // not a replay
+			t.Fatal(err)
+		}
+	}
+	exp, expErr := NewFromFile(name)
+	if expErr == nil {
+		defer exp.Close()
+	}
+	r, err := NewFromFileContext(context.Background(), name)
+	if err != expErr {
+		t.Errorf("Expected: %v, got: %v", expErr, err)
+	}
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	if len(r.GameEvts) != len(exp.GameEvts) || len(r.TrackerEvts.Evts) != len(exp.TrackerEvts.Evts) {
+		t.Errorf("Expected the same events as NewFromFile")
+	}
+
+	// Done after the header: details are not decoded
+	if _, err := NewFromFileContext(&testCountdownCtx{context.Background(), 2}, name); err != context.Canceled {
+		t.Errorf("Expected: %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestNewFromBytes(t *testing.T) {
+	cases := [][]byte{nil, []byte("not a replay"), testMPQ(0, mpqBlockIndexEmpty)}
+	if name := os.Getenv("SC2BANKRECOVER_BENCH_REPLAY"); name != "" {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cases = append(cases, data)
+	}
+	for i, data := range cases {
+		exp, expErr := NewEvts(bytes.NewReader(data), true, false, false)
+		got, err := NewFromBytes(data, true, false, false)
+		if err != expErr {
+			t.Errorf("[%d] Expected: %v, got: %v", i, expErr, err)
+		}
+		if err != nil || expErr != nil {
+			continue
+		}
+		if len(got.GameEvts) != len(exp.GameEvts) || got.TrackerEvts != nil {
+			t.Errorf("[%d] Expected the same events as NewEvts", i)
+		}
+		got.Close()
+		exp.Close()
+	}
+}
+
+func TestNewFromReaderAt(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "short-1v1.SC2Replay"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Close()
+
+	got, err := NewFromReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if got.Header.Loops() != exp.Header.Loops() || len(got.GameEvts) != len(exp.GameEvts) ||
+		len(got.MessageEvts) != len(exp.MessageEvts) || len(got.TrackerEvts.Evts) != len(exp.TrackerEvts.Evts) {
+		t.Errorf("Expected the replay to be read as with New")
+	}
+
+	got, err = NewFromReaderAtEvts(bytes.NewReader(data), int64(len(data)), false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if got.GameEvts != nil || got.MessageEvts != nil || got.TrackerEvts != nil {
+		t.Errorf("Expected no events")
+	}
+
+	// Cut short
+	if _, err := NewFromReaderAt(bytes.NewReader(data), 100); err == nil {
+		t.Errorf("Expected an error of a truncated replay")
+	}
+}
+
+func TestBankEvts(t *testing.T) {
+	evt := func(name string, loop int64) s2prot.Event {
+		return s2prot.Event{EvtType: &s2prot.EvtType{Name: name}, Struct: s2prot.Struct{"loop": loop}}
+	}
+	evts := []s2prot.Event{
+		evt("UserOptions", 0),
+		evt("BankFile", 0),
+		evt("BankSection", 0),
+		evt("BankKey", 0),
+		evt("BankValue", 0),
+		evt("BankSignature", 0),
+		evt("Camera", 0),
+		evt("BankKey", 1),
+		evt("Cmd", 2),
+	}
+	var got []string
+	for _, e := range bankEvts(evts) {
+		got = append(got, e.EvtType.Name)
+	}
+	exp := []string{"BankFile", "BankSection", "BankKey", "BankValue", "BankSignature"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestProtocolOf(t *testing.T) {
+	cases := []struct {
+		baseBuild int64
+		exact     bool
+	}{
+		{int64(s2prot.MaxBaseBuild), true},
+		{int64(s2prot.MaxBaseBuild) + 1000000, false}, // unknown future base build
+	}
+
+	for _, c := range cases {
+		h := s2protrep.Header{Struct: s2prot.Struct{"version": s2prot.Struct{"baseBuild": c.baseBuild}}}
+		p, exact := protocolOf(h)
+		if p == nil {
+			t.Errorf("Expected a protocol for base build %v", c.baseBuild)
+		}
+		if exact != c.exact {
+			t.Errorf("Expected: %v, got: %v", c.exact, exact)
+		}
+	}
+}
+
+// Hashes of sub-files of replays.
+var (
+	testHashDetails        = [3]uint32{620083690, 3548627612, 4013960850}
+	testHashDetailsBackup  = [3]uint32{1421087648, 3590964654, 3400061273}
+	testHashInitData       = [3]uint32{3544165653, 1518242780, 4280631132}
+	testHashInitDataBackup = [3]uint32{868899905, 1282002788, 1614930827}
+)
+
+// testReadFile returns a function reading the sub-files 'files' mapped from their hashes, as newRep reads sub-files.
+func testReadFile(files map[[3]uint32][]byte) func(h1, h2, h3 uint32) ([]byte, error) {
+	return func(h1, h2, h3 uint32) ([]byte, error) {
+		return files[[3]uint32{h1, h2, h3}], nil
+	}
+}
+
+func TestDecodeFallback(t *testing.T) {
+	m, err := newMPQFromFile(filepath.Join("testdata", "short-1v1.SC2Replay"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	p, _ := protocolOf(s2protrep.Header{Struct: s2prot.DecodeHeader(m.UserData())})
+	details, err := m.FileByHash(testHashDetails[0], testHashDetails[1], testHashDetails[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	initData, err := m.FileByHash(testHashInitData[0], testHashInitData[1], testHashInitData[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	implausibleDetails := []byte{5, 0}        // a struct of no fields, so of no players
+	implausibleInitData := make([]byte, 1000) // zeros, so of no slots
+
+	cases := []struct {
+		name    string
+		files   map[[3]uint32][]byte
+		players int // players expected, slots are expected along with them
+		err     error
+	}{
+		{"primary", map[[3]uint32][]byte{testHashDetails: details, testHashInitData: initData}, 2, nil},
+		{"implausible primary, backup", map[[3]uint32][]byte{
+			testHashDetails: implausibleDetails, testHashDetailsBackup: details,
+			testHashInitData: implausibleInitData, testHashInitDataBackup: initData,
+		}, 2, nil},
+		{"implausible primary, no backup", map[[3]uint32][]byte{
+			testHashDetails: implausibleDetails, testHashInitData: implausibleInitData,
+		}, 0, nil},
+		{"missing primary, backup", map[[3]uint32][]byte{testHashDetailsBackup: details, testHashInitDataBackup: initData}, 2, nil},
+		{"missing", nil, 0, s2protrep.ErrInvalidRepFile},
+	}
+	for _, c := range cases {
+		d, err := decodeDetails(p, testReadFile(c.files))
+		if err != c.err || len(d.Players()) != c.players {
+			t.Errorf("[%s] Expected: %v players, error: %v, got: %v players, error: %v", c.name, c.players, c.err, len(d.Players()), err)
+		}
+		i, err := decodeInitData(p, testReadFile(c.files))
+		if err != c.err || (len(i.LobbyState.Slots) > 0) != (c.players > 0) {
+			t.Errorf("[%s] Expected slots: %v, error: %v, got: %v slots, error: %v", c.name, c.players > 0, c.err, len(i.LobbyState.Slots), err)
+		}
+	}
+}
+
+func TestDecodeTrackerEvts(t *testing.T) {
+	p := s2prot.GetProtocol(s2prot.MaxBaseBuild)
+	// A tracker event: gameloop delta of 5, event id 1, an empty struct
+	evt := []byte{3, 0, 9, 10, 9, 2, 5, 0}
+	cases := []struct {
+		name   string
+		data   []byte
+		n      int // events decoded
+		hasErr bool
+	}{
+		{"empty", nil, 0, false},
+		{"whole", append(append([]byte{}, evt...), evt...), 2, false},
+		{"corrupt suffix", append(append([]byte{}, evt...), 0, 0xfe, 0xff, 0xff, 0xff, 0x0f), 1, true},
+		{"corrupt", []byte{0, 0xfe, 0xff, 0xff, 0xff, 0x0f}, 0, true},
+	}
+	for _, c := range cases {
+		evts, err := decodeTrackerEvts(p, c.data)
+		if len(evts) != c.n || (err != nil) != c.hasErr {
+			t.Errorf("[%s] Expected: %v events, error: %v, got: %v events, error: %v", c.name, c.n, c.hasErr, len(evts), err)
+		}
+	}
+}
+
+func FuzzNewFromReader(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("MPQ\x1b"))
+	f.Add([]byte("MPQ\x1a"))
+	f.Add(testMPQ(0, mpqBlockIndexEmpty))
+	// Seed with a real replay if given, as for benchmarks
+	if name := os.Getenv("SC2BANKRECOVER_BENCH_REPLAY"); name != "" {
+		if data, err := os.ReadFile(name); err == nil {
+			f.Add(data)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := New(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		r.Close()
+	})
+}
@@ -0,0 +1,48 @@
+/*
+
+Parsing of toon handles identifying players.
+
+*/
+
+package repm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// regionNames are the names of regions mapped from their ids in toon handles.
+var regionNames = map[int]string{
+	1: "US",
+	2: "EU",
+	3: "KR",
+	5: "CN",
+	6: "SEA",
+}
+
+// ToonInfo returns the components of the toon handle 'toon' of the form "<region>-S2-<realm>-<profile id>",
+// e.g. "2-S2-1-316861" gives EU, 1, 316861.
+// Regions of unknown ids are named after the id, e.g. "Region98".
+// An error is returned if 'toon' is malformed, including the empty toon "0-S2-0-0" of computers and observers.
+func ToonInfo(toon string) (region string, realm int, profileID int64, err error) {
+	parts := strings.Split(toon, "-")
+	if len(parts) != 4 || parts[1] != "S2" {
+		return "", 0, 0, fmt.Errorf("malformed toon handle %q", toon)
+	}
+	regionID, err := strconv.Atoi(parts[0])
+	if err == nil {
+		realm, err = strconv.Atoi(parts[2])
+	}
+	if err == nil {
+		profileID, err = strconv.ParseInt(parts[3], 10, 64)
+	}
+	if err != nil || regionID <= 0 || realm <= 0 || profileID <= 0 {
+		return "", 0, 0, fmt.Errorf("malformed toon handle %q", toon)
+	}
+	region, ok := regionNames[regionID]
+	if !ok {
+		region = fmt.Sprint("Region", regionID)
+	}
+	return region, realm, profileID, nil
+}
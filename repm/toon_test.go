@@ -0,0 +1,34 @@
+package repm
+
+import (
+	"testing"
+)
+
+func TestToonInfo(t *testing.T) {
+	cases := []struct {
+		toon      string
+		region    string
+		realm     int
+		profileID int64
+		err       bool
+	}{
+		{"1-S2-1-1234567", "US", 1, 1234567, false},
+		{"2-S2-2-316861", "EU", 2, 316861, false},
+		{"3-S2-1-42", "KR", 1, 42, false},
+		{"98-S2-1-7", "Region98", 1, 7, false},
+		{"0-S2-0-0", "", 0, 0, true},
+		{"", "", 0, 0, true},
+		{"1-S2-1", "", 0, 0, true},
+		{"1-XX-1-42", "", 0, 0, true},
+		{"1-S2-one-42", "", 0, 0, true},
+	}
+	for _, c := range cases {
+		region, realm, profileID, err := ToonInfo(c.toon)
+		if (err != nil) != c.err {
+			t.Errorf("[%s] Expected error: %v, got: %v", c.toon, c.err, err)
+		}
+		if region != c.region || realm != c.realm || profileID != c.profileID {
+			t.Errorf("[%s] Expected: %v %v %v, got: %v %v %v", c.toon, c.region, c.realm, c.profileID, region, realm, profileID)
+		}
+	}
+}
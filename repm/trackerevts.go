@@ -9,11 +9,26 @@ package repm
 import (
 	"math"
 
+	"github.com/icza/s2prot"
 	s2protrep "github.com/icza/s2prot/rep"
 )
 
 // TrackerEvts contains tracker events and some metrics and data calculated from them.
-type TrackerEvts s2protrep.TrackerEvts
+// It has the fields of s2protrep.TrackerEvts and the stats of players.
+type TrackerEvts struct {
+	// Evts contains the tracker events
+	Evts []s2prot.Event
+
+	// PIDPlayerDescMap is a PlayerDesc map mapped from player ID.
+	PIDPlayerDescMap map[int64]*s2protrep.PlayerDesc
+
+	// ToonPlayerDescMap is a PlayerDesc map mapped from toon.
+	ToonPlayerDescMap map[string]*s2protrep.PlayerDesc `json:"-"`
+
+	// What's modified from what's written by icza.
+	// PIDPlayerStatsMap is a PlayerStats map mapped from player ID, of the players having PlayerStats samples.
+	PIDPlayerStatsMap map[int64]*PlayerStats
+}
 
 // init initializes / preprocesses the tracker events.
 func (t *TrackerEvts) init(rep *Rep) {
@@ -29,10 +44,15 @@ func (t *TrackerEvts) init(rep *Rep) {
 	}
 
 	pidStats := make(map[int64]*stats)
+	rep.finalStats = make(map[int64]s2prot.Struct)
+	t.PIDPlayerStatsMap = make(map[int64]*PlayerStats)
 
-	// first read Player setup events:
-	for _, e := range t.Evts {
+	// Player setup events all occur at loop 0, but main buildings may be born before the setup of their players,
+	// so the loop 0 window is pre-scanned for them. Stats are read in the next, single pass over all events.
+	n0 := len(t.Evts) // number of events of loop 0
+	for i, e := range t.Evts {
 		if e.Loop() > 0 {
+			n0 = i
 			break
 		}
 		if e.ID != s2protrep.TrackerEvtIDPlayerSetup {
@@ -52,9 +72,10 @@ func (t *TrackerEvts) init(rep *Rep) {
 	cx := rep.InitData.GameDescription.MapSizeX() / 2
 	cy := rep.InitData.GameDescription.MapSizeY() / 2
 
-	for _, e := range t.Evts {
-		if e.Loop() == 0 && e.ID == s2protrep.TrackerEvtIDUnitBorn {
-			if isMainBuilding(e.Stringv("unitTypeName")) {
+	for i, e := range t.Evts {
+		switch e.ID {
+		case s2protrep.TrackerEvtIDUnitBorn:
+			if i < n0 && isMainBuilding(e.Stringv("unitTypeName")) {
 				pd := pidPlayerDescMap[e.Int("controlPlayerId")]
 				if pd != nil {
 					pd.StartLocX = e.Int("x")
@@ -62,13 +83,12 @@ func (t *TrackerEvts) init(rep *Rep) {
 					pd.StartDir = angleToClock(math.Atan2(float64(pd.StartLocY-cy), float64(pd.StartLocX-cx)))
 				}
 			}
-		}
-
-		if e.ID == s2protrep.TrackerEvtIDPlayerStats {
+		case s2protrep.TrackerEvtIDPlayerStats:
 			pid := e.Int("playerId")
 			st := pidStats[pid]
 			if st != nil {
 				ss := e.Structv("stats")
+				rep.finalStats[pid] = ss
 				st.samples++
 				st.unspents += ss.Int("scoreValueMineralsCurrent") + ss.Int("scoreValueVespeneCurrent")
 				st.incomes += ss.Int("scoreValueMineralsCollectionRate") + ss.Int("scoreValueVespeneCollectionRate")
@@ -85,7 +105,9 @@ func (t *TrackerEvts) init(rep *Rep) {
 		if st == nil || st.samples == 0 {
 			continue
 		}
-		pd.SQ = calcSQ(st.unspents/st.samples, st.incomes/st.samples)
+		ps := &PlayerStats{AvgUnspent: st.unspents / st.samples, AvgIncome: st.incomes / st.samples, Samples: st.samples}
+		t.PIDPlayerStatsMap[pid] = ps
+		pd.SQ = calcSQ(ps.AvgUnspent, ps.AvgIncome)
 		pd.SupplyCappedPercent = int32(st.supCapped * 100 / st.samples)
 	}
 
@@ -97,6 +119,74 @@ func (t *TrackerEvts) init(rep *Rep) {
 	}
 }
 
+// PlayerStats are the averages of a player over its PlayerStats samples, SQ and SupplyCappedPercent
+// of the player description are calculated from.
+type PlayerStats struct {
+	AvgUnspent int64 // Average unspent resources, minerals and vespene
+	AvgIncome  int64 // Average resource collection rate, minerals and vespene
+	Samples    int64 // Number of PlayerStats samples
+}
+
+// PlayerStats returns the stats of the player of the toon handle 'toon' averaged over its PlayerStats samples,
+// as in TrackerEvts.PIDPlayerStatsMap.
+// ok is false if tracker events were not decoded or there are no samples of the player.
+func (r *Rep) PlayerStats(toon string) (stats PlayerStats, ok bool) {
+	if r.TrackerEvts == nil {
+		return stats, false
+	}
+	pd := r.TrackerEvts.ToonPlayerDescMap[toon]
+	if pd == nil {
+		return stats, false
+	}
+	ps := r.TrackerEvts.PIDPlayerStatsMap[pd.PlayerID]
+	if ps == nil {
+		return stats, false
+	}
+	return *ps, true
+}
+
+// Scores are scores of a player read from a PlayerStats sample.
+type Scores struct {
+	MineralsLost       int64 // Minerals lost in army, economy and technology
+	VespeneLost        int64 // Vespene lost in army, economy and technology
+	ArmyValue          int64 // Minerals and vespene used in the current army
+	ResourcesCollected int64 // Minerals and vespene unspent, used (current and in progress) and lost; not sampled as such
+}
+
+// FinalScores returns the scores of the player of the toon handle 'toon' read from its last PlayerStats sample.
+// ok is false if tracker events were not decoded or there are no samples of the player.
+func (r *Rep) FinalScores(toon string) (scores Scores, ok bool) {
+	if r.TrackerEvts == nil {
+		return scores, false
+	}
+	pd := r.TrackerEvts.ToonPlayerDescMap[toon]
+	if pd == nil {
+		return scores, false
+	}
+	ss, ok := r.finalStats[pd.PlayerID]
+	if !ok {
+		return scores, false
+	}
+
+	sum := func(res string, names ...string) (n int64) {
+		for _, name := range names {
+			n += ss.Int("scoreValue" + res + name)
+		}
+		return n
+	}
+	lost := []string{"LostArmy", "LostEconomy", "LostTechnology"}
+	used := []string{"UsedCurrentArmy", "UsedCurrentEconomy", "UsedCurrentTechnology",
+		"UsedInProgressArmy", "UsedInProgressEconomy", "UsedInProgressTechnology"}
+
+	scores.MineralsLost = sum("Minerals", lost...)
+	scores.VespeneLost = sum("Vespene", lost...)
+	scores.ArmyValue = sum("Minerals", "UsedCurrentArmy") + sum("Vespene", "UsedCurrentArmy")
+	for _, res := range []string{"Minerals", "Vespene"} {
+		scores.ResourcesCollected += sum(res, "Current") + sum(res, used...) + sum(res, lost...)
+	}
+	return scores, true
+}
+
 // isMainBuilding tells if the unit type name denots a main building, that is
 // one of Nexus, Command Center and Hatchery.
 func isMainBuilding(unitTypeName string) bool {
@@ -2,7 +2,11 @@ package repm
 
 import (
 	"math"
+	"reflect"
 	"testing"
+
+	"github.com/icza/s2prot"
+	s2protrep "github.com/icza/s2prot/rep"
 )
 
 func TestIsMainBuilding(t *testing.T) {
@@ -80,3 +84,147 @@ func TestCalcSQ(t *testing.T) {
 		}
 	}
 }
+
+func TestFinalScores(t *testing.T) {
+	playerStats := &s2prot.EvtType{ID: s2protrep.TrackerEvtIDPlayerStats, Name: "PlayerStats"}
+	playerSetup := &s2prot.EvtType{ID: s2protrep.TrackerEvtIDPlayerSetup, Name: "PlayerSetup"}
+	stats := func(loop, army int64) s2prot.Event {
+		return s2prot.Event{EvtType: playerStats, Struct: s2prot.Struct{"loop": loop, "playerId": int64(1), "stats": s2prot.Struct{
+			"scoreValueMineralsCurrent":         int64(50),
+			"scoreValueMineralsUsedCurrentArmy": army,
+			"scoreValueVespeneUsedCurrentArmy":  int64(25),
+			"scoreValueMineralsLostArmy":        int64(100),
+			"scoreValueMineralsLostEconomy":     int64(50),
+			"scoreValueVespeneLostTechnology":   int64(75),
+		}}}
+	}
+
+	r := &Rep{InitData: s2protrep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+		"lobbyState": s2prot.Struct{"slots": []interface{}{s2prot.Struct{"toonHandle": "1-S2-1-1"}}},
+	}})}
+	r.TrackerEvts = &TrackerEvts{Evts: []s2prot.Event{
+		{EvtType: playerSetup, Struct: s2prot.Struct{"loop": int64(0), "playerId": int64(1), "slotId": int64(0)}},
+		stats(160, 200),
+		stats(320, 400),
+	}}
+	r.TrackerEvts.init(r)
+
+	got, ok := r.FinalScores("1-S2-1-1")
+	exp := Scores{MineralsLost: 150, VespeneLost: 75, ArmyValue: 425, ResourcesCollected: 50 + 400 + 25 + 150 + 75}
+	if !ok || got != exp {
+		t.Errorf("Expected: %v, got: %v (ok: %v)", exp, got, ok)
+	}
+
+	if _, ok := r.FinalScores("1-S2-1-2"); ok {
+		t.Errorf("Expected no scores of unknown toon")
+	}
+	if _, ok := (&Rep{}).FinalScores("1-S2-1-1"); ok {
+		t.Errorf("Expected no scores without tracker events")
+	}
+}
+
+func TestPlayerStats(t *testing.T) {
+	playerStats := &s2prot.EvtType{ID: s2protrep.TrackerEvtIDPlayerStats, Name: "PlayerStats"}
+	playerSetup := &s2prot.EvtType{ID: s2protrep.TrackerEvtIDPlayerSetup, Name: "PlayerSetup"}
+	stats := func(loop, unspent, income int64) s2prot.Event {
+		return s2prot.Event{EvtType: playerStats, Struct: s2prot.Struct{"loop": loop, "playerId": int64(1), "stats": s2prot.Struct{
+			"scoreValueMineralsCurrent":        unspent,
+			"scoreValueVespeneCurrent":         int64(100),
+			"scoreValueMineralsCollectionRate": income,
+			"scoreValueVespeneCollectionRate":  int64(200),
+		}}}
+	}
+
+	r := &Rep{InitData: s2protrep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+		"lobbyState": s2prot.Struct{"slots": []interface{}{s2prot.Struct{"toonHandle": "1-S2-1-1"}, s2prot.Struct{"toonHandle": "1-S2-1-2"}}},
+	}})}
+	r.TrackerEvts = &TrackerEvts{Evts: []s2prot.Event{
+		{EvtType: playerSetup, Struct: s2prot.Struct{"loop": int64(0), "playerId": int64(1), "slotId": int64(0)}},
+		{EvtType: playerSetup, Struct: s2prot.Struct{"loop": int64(0), "playerId": int64(2), "slotId": int64(1)}},
+		stats(160, 300, 600),
+		stats(320, 500, 1000),
+	}}
+	r.TrackerEvts.init(r)
+
+	got, ok := r.PlayerStats("1-S2-1-1")
+	exp := PlayerStats{AvgUnspent: 500, AvgIncome: 1000, Samples: 2}
+	if !ok || got != exp {
+		t.Errorf("Expected: %v, got: %v (ok: %v)", exp, got, ok)
+	}
+	if sq := r.TrackerEvts.ToonPlayerDescMap["1-S2-1-1"].SQ; sq != calcSQ(exp.AvgUnspent, exp.AvgIncome) {
+		t.Errorf("Expected: %v, got: %v", calcSQ(exp.AvgUnspent, exp.AvgIncome), sq)
+	}
+
+	if ps := r.TrackerEvts.PIDPlayerStatsMap[1]; ps == nil || *ps != exp {
+		t.Errorf("Expected: %v, got: %v", exp, ps)
+	}
+
+	if _, ok := r.PlayerStats("1-S2-1-2"); ok {
+		t.Errorf("Expected no stats of player without samples")
+	}
+	if ps := r.TrackerEvts.PIDPlayerStatsMap[2]; ps != nil {
+		t.Errorf("Expected no stats of player without samples, got: %v", ps)
+	}
+	if _, ok := (&Rep{}).PlayerStats("1-S2-1-1"); ok {
+		t.Errorf("Expected no stats without tracker events")
+	}
+}
+
+func TestTrackerEvtsInit(t *testing.T) {
+	playerStats := &s2prot.EvtType{ID: s2protrep.TrackerEvtIDPlayerStats, Name: "PlayerStats"}
+	playerSetup := &s2prot.EvtType{ID: s2protrep.TrackerEvtIDPlayerSetup, Name: "PlayerSetup"}
+	unitBorn := &s2prot.EvtType{ID: s2protrep.TrackerEvtIDUnitBorn, Name: "UnitBorn"}
+	born := func(loop, pid, x, y int64) s2prot.Event {
+		return s2prot.Event{EvtType: unitBorn, Struct: s2prot.Struct{"loop": loop, "controlPlayerId": pid,
+			"unitTypeName": "Nexus", "x": x, "y": y}}
+	}
+	stats := func(loop, pid, used, made int64) s2prot.Event {
+		return s2prot.Event{EvtType: playerStats, Struct: s2prot.Struct{"loop": loop, "playerId": pid, "stats": s2prot.Struct{
+			"scoreValueMineralsCurrent":        int64(400),
+			"scoreValueMineralsCollectionRate": int64(800),
+			"scoreValueFoodUsed":               used,
+			"scoreValueFoodMade":               made,
+		}}}
+	}
+
+	r := &Rep{InitData: s2protrep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+		"gameDescription": s2prot.Struct{"mapSizeX": int64(100), "mapSizeY": int64(100)},
+		"lobbyState":      s2prot.Struct{"slots": []interface{}{s2prot.Struct{"toonHandle": "1-S2-1-1"}, s2prot.Struct{"toonHandle": "1-S2-1-2"}}},
+	}})}
+	r.TrackerEvts = &TrackerEvts{Evts: []s2prot.Event{
+		born(0, 2, 10, 50), // main building born before the setup of its player
+		{EvtType: playerSetup, Struct: s2prot.Struct{"loop": int64(0), "playerId": int64(1), "slotId": int64(0), "userId": int64(0)}},
+		{EvtType: playerSetup, Struct: s2prot.Struct{"loop": int64(0), "playerId": int64(2), "slotId": int64(1), "userId": int64(1)}},
+		born(0, 1, 90, 50),
+		stats(0, 1, 10, 10),
+		born(160, 1, 50, 90), // past loop 0, not a start location
+		stats(160, 1, 10, 20),
+		stats(320, 2, 20, 20),
+		{EvtType: playerSetup, Struct: s2prot.Struct{"loop": int64(320), "playerId": int64(3), "slotId": int64(1)}}, // past loop 0, ignored
+		stats(480, 3, 20, 20),
+	}}
+	r.TrackerEvts.init(r)
+
+	exp := map[int64]*s2protrep.PlayerDesc{
+		1: {PlayerID: 1, SlotID: 0, UserID: 0, StartLocX: 90, StartLocY: 50, StartDir: 3, SQ: calcSQ(400, 800), SupplyCappedPercent: 50},
+		2: {PlayerID: 2, SlotID: 1, UserID: 1, StartLocX: 10, StartLocY: 50, StartDir: 9, SQ: calcSQ(400, 800), SupplyCappedPercent: 100},
+	}
+	if !reflect.DeepEqual(r.TrackerEvts.PIDPlayerDescMap, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, r.TrackerEvts.PIDPlayerDescMap)
+	}
+	if got := r.TrackerEvts.ToonPlayerDescMap["1-S2-1-2"]; got != r.TrackerEvts.PIDPlayerDescMap[2] {
+		t.Errorf("Expected: %v, got: %v", r.TrackerEvts.PIDPlayerDescMap[2], got)
+	}
+}
+
+func BenchmarkTrackerEvtsInit(b *testing.B) {
+	r, err := NewFromFileEvts(benchReplay(b), false, false, true)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.TrackerEvts.init(r)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+
+Sanity checks of sub-files in the versioned encoding, guarding the decoders of s2prot against crafted input.
+
+*/
+
+package repm
+
+// maxVersionedDepth is the deepest nesting of versioned instances accepted, far deeper than that of any real sub-file.
+const maxVersionedDepth = 64
+
+// versionedSane tells if 'data' starts with a whole versioned instance having sane lengths (see versionedPrefix),
+// that is, if decoding a single instance from it is safe.
+func versionedSane(data []byte) bool {
+	_, ok := versionedSkip(data, 0, 0)
+	return ok
+}
+
+// versionedPrefix returns the length of the longest prefix of 'data' made of whole versioned instances
+// having sane lengths: an array, struct, blob or bit array is never longer than the bytes left,
+// since the decoders of s2prot allocate what the length tells before reading a byte of the content.
+// Decoding the prefix only never allocates more than a few times the size of 'data'.
+func versionedPrefix(data []byte) int {
+	n := 0
+	for n < len(data) {
+		end, ok := versionedSkip(data, n, 0)
+		if !ok {
+			break
+		}
+		n = end
+	}
+	return n
+}
+
+// versionedSkip returns the offset in 'data' right after the versioned instance at the offset 'off',
+// nested at the depth 'depth'. ok is false if the instance is cut short or has an insane length.
+func versionedSkip(data []byte, off, depth int) (end int, ok bool) {
+	if depth > maxVersionedDepth || off >= len(data) {
+		return 0, false
+	}
+	// length reads a varint length at 'off' no greater than the bytes left after it
+	length := func() (int, bool) {
+		v, next, ok := versionedVarInt(data, off)
+		if !ok || v < 0 || v > int64(len(data)-next) {
+			return 0, false
+		}
+		off = next
+		return int(v), true
+	}
+	fieldType := data[off]
+	off++
+	switch fieldType {
+	case 0: // array
+		n, ok := length()
+		if !ok {
+			return 0, false
+		}
+		for ; n > 0; n-- {
+			if off, ok = versionedSkip(data, off, depth+1); !ok {
+				return 0, false
+			}
+		}
+	case 1: // bit array
+		n, next, ok := versionedVarInt(data, off)
+		if !ok || n < 0 || n > 8*int64(len(data)-next) {
+			return 0, false
+		}
+		off = next + int((n+7)/8)
+	case 2: // blob
+		n, ok := length()
+		if !ok {
+			return 0, false
+		}
+		off += n
+	case 3: // choice
+		_, next, ok := versionedVarInt(data, off)
+		if !ok {
+			return 0, false
+		}
+		return versionedSkip(data, next, depth+1)
+	case 4: // optional
+		if off >= len(data) {
+			return 0, false
+		}
+		off++
+		if data[off-1] != 0 {
+			return versionedSkip(data, off, depth+1)
+		}
+	case 5: // struct
+		n, ok := length()
+		if !ok {
+			return 0, false
+		}
+		for ; n > 0; n-- {
+			_, next, ok := versionedVarInt(data, off) // tag
+			if !ok {
+				return 0, false
+			}
+			if off, ok = versionedSkip(data, next, depth+1); !ok {
+				return 0, false
+			}
+		}
+	case 6: // uint8
+		off++
+	case 7: // uint32
+		off += 4
+	case 8: // uint64
+		off += 8
+	case 9: // varint
+		_, next, ok := versionedVarInt(data, off)
+		if !ok {
+			return 0, false
+		}
+		off = next
+	default:
+		return 0, false
+	}
+	if off > len(data) {
+		return 0, false
+	}
+	return off, true
+}
+
+// versionedVarInt reads a varint of the versioned encoding at the offset 'off' of 'data',
+// returning its value and the offset after it. ok is false if it is cut short or overflows.
+func versionedVarInt(data []byte, off int) (v int64, next int, ok bool) {
+	var value uint64
+	for shift := uint(0); off < len(data); shift += 7 {
+		if shift > 63 {
+			return 0, 0, false
+		}
+		b := data[off]
+		off++
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			if value&1 != 0 {
+				return -int64(value >> 1), off, true
+			}
+			return int64(value >> 1), off, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,38 @@
+package repm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVersionedPrefix(t *testing.T) {
+	deep := append(bytes.Repeat([]byte{4, 1}, maxVersionedDepth+1), 9, 0) // optionals nested too deep
+	cases := []struct {
+		name   string
+		data   []byte
+		prefix int
+	}{
+		{"empty", nil, 0},
+		{"varint", []byte{9, 0x0a}, 2},
+		{"struct", []byte{5, 2, 0, 9, 0x0a}, 5},
+		{"blob", []byte{2, 6, 'a', 'b', 'c'}, 5},
+		{"bit array", []byte{1, 18, 0xff, 0x01}, 4},
+		{"array of uint8", []byte{0, 4, 6, 1, 6, 2}, 6},
+		{"instances", []byte{9, 0x0a, 7, 1, 2, 3, 4, 4, 0}, 9},
+		{"trailing cut blob", []byte{9, 0x0a, 2, 6, 'a'}, 2},
+		{"huge array", []byte{0, 0xfe, 0xff, 0xff, 0xff, 0x0f, 6, 1}, 0},
+		{"negative length", []byte{2, 3}, 0},
+		{"cut varint", []byte{9, 0x80}, 0},
+		{"unknown field type", []byte{10, 0}, 0},
+		{"too deep", deep, 0},
+		{"deep", deep[2:], len(deep) - 2},
+	}
+	for _, c := range cases {
+		if prefix := versionedPrefix(c.data); prefix != c.prefix {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, c.prefix, prefix)
+		}
+		if sane := versionedSane(c.data); sane != (c.prefix > 0) {
+			t.Errorf("[%s] Expected sane: %v, got: %v", c.name, c.prefix > 0, sane)
+		}
+	}
+}
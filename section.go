@@ -0,0 +1,407 @@
+package bankrecover
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/icza/s2prot"
+)
+
+// BankValueType is the type of a bank value as given by the "type" field of bank events.
+type BankValueType int
+
+// Bank value types, in the order the game encodes them.
+const (
+	BankValueTypeFixed BankValueType = iota
+	BankValueTypeFlag
+	BankValueTypeInt
+	BankValueTypeString
+	BankValueTypePoint
+	BankValueTypeUnit
+	BankValueTypeText
+)
+
+// BankValueTypeUnknown stands for value types out of the range of the known ones, see TypeHistogram.
+const BankValueTypeUnknown BankValueType = -1
+
+// bankValueTypeNext tells that the value will be in the next message.
+const bankValueTypeNext BankValueType = 7
+
+// bankValueTypeNames are the attribute names of value types used in .SC2Bank files.
+// Values of all types are written as a single attribute holding the data as the game streamed it in the replay;
+// point and unit values are not broken down into sub-elements, the stream carries them as flat strings too.
+var bankValueTypeNames = []string{
+	"fixed",
+	"flag",
+	"int",
+	"string",
+	"point",
+	"unit",
+	"text",
+}
+
+// String returns the attribute name of the value type as used in .SC2Bank files.
+func (typ BankValueType) String() string {
+	if typ < 0 || int(typ) >= len(bankValueTypeNames) {
+		return fmt.Sprintf("BankValueType(%d)", int(typ))
+	}
+	return bankValueTypeNames[typ]
+}
+
+// bankEventValue returns the value type and the data carried by the bank event 'evt'.
+// ok is false if the event carries no value type, as a "BankKey" event holding no value inline.
+func bankEventValue(evt s2prot.Event) (typ BankValueType, data string, ok bool) {
+	return BankValueType(evt.Int("type")), evt.Stringv("data"), evt.Value("type") != nil
+}
+
+// Section is a section of a bank.
+type Section struct {
+	Name string
+	Keys []Key
+}
+
+// Key is a key of a bank section.
+type Key struct {
+	Name   string
+	Values []Value
+}
+
+// Value is a typed value of a bank key.
+type Value struct {
+	Name string // element name, "Value" unless the game named it otherwise
+	Type BankValueType
+	Data string
+
+	evt int // index of the source event in Bank.GameEvents
+}
+
+// ModelOptions tunes how the section/key model of a bank is built.
+type ModelOptions struct {
+	// TrimSpace trims leading and trailing white space off string and text values.
+	// The game preserves white space and so does the model by default,
+	// but padded values break equality checks in analytics.
+	TrimSpace bool
+}
+
+// Sections returns the section/key model of this bank decoded from its game events.
+func (bank *Bank) Sections() []Section {
+	return bank.SectionsWithOptions(ModelOptions{})
+}
+
+// SectionsWithOptions returns the section/key model of this bank built as told by 'opts'.
+// Keys preceding any section and values preceding any key of their section are left out,
+// streams of the game never have them.
+func (bank *Bank) SectionsWithOptions(opts ModelOptions) []Section {
+	return bank.sections(opts, nopLogger{})
+}
+
+// sections returns the section/key model of this bank as SectionsWithOptions does,
+// reporting to 'warn' the events left out, the keys whose split value never came,
+// and the values of unknown types, which WriteTo drops.
+func (bank *Bank) sections(opts ModelOptions, warn Logger) []Section {
+	var sections []Section
+	var section *Section
+	var key *Key
+	pending := false // tells if the current key is of a type-7 event awaiting its value
+	// valueMissing reports the value of a pending key which the next message didn't bring
+	valueMissing := func() {
+		if pending {
+			warn.Printf("Warning: Value of key %q missing of bank %q", key.Name, bank.Name)
+			pending = false
+		}
+	}
+	for i, evt := range bank.GameEvents {
+		switch evt.EvtType.Name {
+		case EvtTypeBankSection:
+			valueMissing()
+			sections = append(sections, Section{Name: evt.Stringv("name")})
+			section = &sections[len(sections)-1]
+			key = nil
+			continue
+		case EvtTypeBankKey:
+			valueMissing()
+			if section == nil { // stray key of malformed events
+				warn.Printf("Warning: Key %q of no section dropped of bank %q", evt.Stringv("name"), bank.Name)
+				continue
+			}
+			section.Keys = append(section.Keys, Key{Name: evt.Stringv("name")})
+			key = &section.Keys[len(section.Keys)-1]
+			if _, _, ok := bankEventValue(evt); !ok {
+				continue
+			}
+			fallthrough // goto EvtTypeBankValue
+		case EvtTypeBankValue:
+			if key == nil { // stray value of malformed events
+				warn.Printf("Warning: Value %q of no key dropped of bank %q", evt.Stringv("name"), bank.Name)
+				continue
+			}
+			typ, data, _ := bankEventValue(evt)
+			// The value of a type-7 event is in the next message, which is consumed by the pending key
+			if pending = typ == bankValueTypeNext; pending {
+				continue
+			}
+			if typ < BankValueTypeFixed || typ > BankValueTypeText {
+				warn.Printf("Warning: Value of unknown type %d dropped of key %q of bank %q", int(typ), key.Name, bank.Name)
+			}
+			name := evt.Stringv("name")
+			if name == key.Name {
+				name = "Value"
+			}
+			if opts.TrimSpace && (typ == BankValueTypeString || typ == BankValueTypeText) {
+				data = strings.TrimSpace(data)
+			}
+			key.Values = append(key.Values, Value{Name: name, Type: typ, Data: data, evt: i})
+			continue
+		case EvtTypeBankSignature:
+			valueMissing()
+		}
+	}
+	valueMissing()
+	return sections
+}
+
+// Lookup returns the value of the key 'key' in the section 'section' of this bank.
+// If the key is written more than once, the last value written is returned, as in the game.
+// ok is false if the bank has no such key.
+func (bank *Bank) Lookup(section, key string) (v Value, ok bool) {
+	for _, s := range bank.Sections() {
+		if s.Name != section {
+			continue
+		}
+		for _, k := range s.Keys {
+			if k.Name == key && len(k.Values) > 0 {
+				v, ok = k.Values[len(k.Values)-1], true
+			}
+		}
+	}
+	return v, ok
+}
+
+// collapseSections returns 'sections' with the sections of the same name merged into the first of them,
+// and the keys of the same name within a section merged into the first of them holding the values of the last write,
+// as the game keeps them. Sections and keys are in order of first write.
+func collapseSections(sections []Section) []Section {
+	var ret []Section
+	iSection := map[string]int{} // section name => index in ret
+	iKey := map[SectionKey]int{} // key => index in the keys of its section in ret
+	for _, section := range sections {
+		i, ok := iSection[section.Name]
+		if !ok {
+			i = len(ret)
+			iSection[section.Name] = i
+			ret = append(ret, Section{Name: section.Name})
+		}
+		for _, key := range section.Keys {
+			k := SectionKey{section.Name, key.Name}
+			j, ok := iKey[k]
+			if !ok {
+				j = len(ret[i].Keys)
+				iKey[k] = j
+				ret[i].Keys = append(ret[i].Keys, Key{Name: key.Name})
+			}
+			if len(key.Values) > 0 {
+				ret[i].Keys[j].Values = key.Values
+			}
+		}
+	}
+	return ret
+}
+
+// Collisions returns the keys of this bank written more than once in their section, as "<section>/<key>",
+// in order of first write. WriteTo keeps the values of the last write of them, overwriting the earlier ones as the game does.
+// Keys of a section written more than once count as written in the same section.
+func (bank *Bank) Collisions() []string {
+	var keys []SectionKey // keys in order of first write
+	writes := map[SectionKey]int{}
+	for _, section := range bank.Sections() {
+		for _, key := range section.Keys {
+			k := SectionKey{section.Name, key.Name}
+			if writes[k]++; writes[k] == 1 {
+				keys = append(keys, k)
+			}
+		}
+	}
+	var ret []string
+	for _, k := range keys {
+		if writes[k] > 1 {
+			ret = append(ret, k.Section+"/"+k.Key)
+		}
+	}
+	return ret
+}
+
+// RangeKeys calls 'fn' for each value of this bank as WriteTo writes it out, in the order written,
+// with the names of its section and key, the attribute name of its type and its data.
+// Iteration stops once 'fn' returns false.
+// Sections and keys written more than once are merged as the game keeps them, a key holding the values of its last write;
+// split values of type-7 events are given as the value the next message brought.
+// Keys lacking a value and values of unknown types are skipped, as WriteTo writes no value of them.
+func (bank *Bank) RangeKeys(fn func(section, key, valueType, data string) bool) {
+	for _, section := range collapseSections(bank.Sections()) {
+		for _, key := range section.Keys {
+			for _, v := range key.Values {
+				if v.Type < BankValueTypeFixed || v.Type > BankValueTypeText {
+					continue
+				}
+				if !fn(section.Name, key.Name, v.Type.String(), v.Data) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// KeyCount returns the number of distinct keys of this bank, over all sections.
+// A key written more than once in a section, or in a section written more than once, is counted once, as the game keeps it.
+func (bank *Bank) KeyCount() int {
+	n := 0
+	for _, section := range collapseSections(bank.Sections()) {
+		n += len(section.Keys)
+	}
+	return n
+}
+
+// TypeHistogram returns the number of keys of this bank of each value type, counted as KeyCount counts keys.
+// A key counts as of the type of its last value, keys lacking a value are not counted.
+// Types out of the range of the known ones are counted under BankValueTypeUnknown.
+func (bank *Bank) TypeHistogram() map[BankValueType]int {
+	ret := map[BankValueType]int{}
+	for _, section := range collapseSections(bank.Sections()) {
+		for _, key := range section.Keys {
+			if len(key.Values) == 0 {
+				continue
+			}
+			typ := key.Values[0].Type
+			if typ < BankValueTypeFixed || typ > BankValueTypeText {
+				typ = BankValueTypeUnknown
+			}
+			ret[typ]++
+		}
+	}
+	return ret
+}
+
+// EmptySections returns the names of the sections of this bank having no keys, in game event order.
+func (bank *Bank) EmptySections() []string {
+	var ret []string
+	for _, section := range bank.Sections() {
+		if len(section.Keys) == 0 {
+			ret = append(ret, section.Name)
+		}
+	}
+	return ret
+}
+
+// FlatKey is a value of a key of a player's bank flattened out of the section/key model.
+type FlatKey struct {
+	Bank    string
+	Section string
+	Key     string
+	Type    BankValueType
+	Value   string
+}
+
+// FlattenPlayerBanks returns every value of every key across all banks of a player.
+// 'playerBanks' is an element of what NewBanksFromReplay returns.
+// Banks are ordered by name, and values within a bank are in game event order.
+func FlattenPlayerBanks(playerBanks map[string]*Bank) []FlatKey {
+	var ret []FlatKey
+	for _, name := range sortedBankNames(playerBanks) {
+		for _, section := range playerBanks[name].Sections() {
+			for _, key := range section.Keys {
+				for _, v := range key.Values {
+					ret = append(ret, FlatKey{
+						Bank:    name,
+						Section: section.Name,
+						Key:     key.Name,
+						Type:    v.Type,
+						Value:   v.Data,
+					})
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// TransformValues returns a copy of this bank with 'fn' applied to every value in the section/key model.
+// The value is replaced with what 'fn' returns. The original bank is left unmodified.
+func (bank *Bank) TransformValues(fn func(section, key string, typ BankValueType, value string) string) *Bank {
+	evts := make([]s2prot.Event, len(bank.GameEvents))
+	copy(evts, bank.GameEvents)
+	for _, section := range bank.Sections() {
+		for _, key := range section.Keys {
+			for _, v := range key.Values {
+				data := fn(section.Name, key.Name, v.Type, v.Data)
+				if data == v.Data {
+					continue
+				}
+				evts[v.evt] = withField(evts[v.evt], "data", data)
+			}
+		}
+	}
+	return bank.withEvents(evts)
+}
+
+// SectionKey names a key of a bank section.
+type SectionKey struct {
+	Section string
+	Key     string
+}
+
+// Subset returns a copy of this bank holding only the keys 'keys', along with their values and types,
+// and the sections of them. Keys this bank doesn't have are omitted.
+// The signature is left out, it wouldn't match the subset. The original bank is left unmodified.
+func (bank *Bank) Subset(keys []SectionKey) *Bank {
+	wanted := make(map[SectionKey]bool, len(keys))
+	for _, k := range keys {
+		wanted[k] = true
+	}
+	var evts []s2prot.Event
+	var sectionEvt *s2prot.Event // event of the current section, until written
+	var section string
+	keep := false // tells if the current key is kept
+	for i, evt := range bank.GameEvents {
+		switch evt.EvtType.Name {
+		case EvtTypeBankSection:
+			section = evt.Stringv("name")
+			sectionEvt = &bank.GameEvents[i]
+			keep = false
+		case EvtTypeBankKey:
+			if keep = wanted[SectionKey{section, evt.Stringv("name")}]; !keep {
+				continue
+			}
+			if sectionEvt != nil {
+				evts = append(evts, *sectionEvt)
+				sectionEvt = nil
+			}
+			evts = append(evts, evt)
+		case EvtTypeBankValue:
+			if keep {
+				evts = append(evts, evt)
+			}
+		case EvtTypeBankSignature:
+		default:
+			evts = append(evts, evt)
+		}
+	}
+	return bank.withEvents(evts)
+}
+
+// withEvents returns a shallow copy of this bank holding the game events 'evts' instead.
+func (bank *Bank) withEvents(evts []s2prot.Event) *Bank {
+	ret := *bank
+	ret.GameEvents = evts
+	return &ret
+}
+
+// withField returns a copy of the event 'evt' having its field 'name' set to 'value'.
+// The struct of the original event is not modified.
+func withField(evt s2prot.Event, name string, value interface{}) s2prot.Event {
+	s := make(s2prot.Struct, len(evt.Struct)+1)
+	for k, v := range evt.Struct {
+		s[k] = v
+	}
+	s[name] = value
+	return s2prot.Event{Struct: s, EvtType: evt.EvtType}
+}
@@ -0,0 +1,124 @@
+package bankrecover
+
+import (
+	"github.com/icza/s2prot"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// SharedControl tells if the game of the replay 'r' was played with advanced shared control,
+// letting teammates control each other's units and so write to the same bank under different user IDs.
+func SharedControl(r *repm.Rep) bool {
+	return r.InitData.GameDescription.GameOptions.AdvancedSharedControl()
+}
+
+// NewSharedBanksByTeam returns the banks of all players in a replay merged by name across allied slots.
+// ret[team][strBankName] gives the bank consolidated out of the banks of that name of all players of the team,
+// where team is the 1-based team number as in NewBanksByTeam.
+// Banks of players without a team are left out, as they have no allies to share banks with.
+//
+// Keys written by more than one player are reconciled by keeping the write of the highest game loop,
+// and of the highest player index among writes of the same loop.
+// Sections and keys are ordered as first written, by player index.
+// A merged bank is owned by the player of the lowest index having the bank, and has no signature
+// since the signatures of the players' banks don't match the merged content.
+// A bank of a single player of the team is returned as recovered.
+//
+// Merging is meant for shared-control maps, see SharedControl;
+// the banks of teammates not sharing control are their own, and merging them mixes up their progress.
+func NewSharedBanksByTeam(r *repm.Rep) (ret map[int]map[string]*Bank) {
+	ret = map[int]map[string]*Bank{}
+	for team, banks := range NewBanksByTeam(r) {
+		if team == 0 {
+			continue
+		}
+		byName := map[string][]*Bank{}
+		var names []string
+		for _, bank := range banks {
+			if byName[bank.Name] == nil {
+				names = append(names, bank.Name)
+			}
+			byName[bank.Name] = append(byName[bank.Name], bank)
+		}
+		ret[team] = map[string]*Bank{}
+		for _, name := range names {
+			if banks := byName[name]; len(banks) == 1 {
+				ret[team][name] = banks[0]
+			} else {
+				ret[team][name] = mergeBanks(banks)
+			}
+		}
+	}
+	return ret
+}
+
+// mergeBanks returns the bank consolidated out of the banks 'banks' of the same name, as NewSharedBanksByTeam does.
+// 'banks' are ordered by player index.
+func mergeBanks(banks []*Bank) *Bank {
+	// writeOfKey is how a key was written: its "BankKey" event followed by its "BankValue" events
+	type writeOfKey struct {
+		loop int64
+		evts []s2prot.Event
+	}
+	var sections []s2prot.Event            // first "BankSection" event of each section, in order
+	keys := map[string][]string{}          // section name => key names, in order
+	writes := map[SectionKey]*writeOfKey{} // key => the write kept
+	var section string
+	var curr *writeOfKey // write of the current key, until done
+	done := func() {
+		if curr == nil {
+			return
+		}
+		k := SectionKey{section, curr.evts[0].Stringv("name")}
+		if kept, ok := writes[k]; !ok {
+			keys[section] = append(keys[section], k.Key)
+			writes[k] = curr
+		} else if curr.loop >= kept.loop {
+			writes[k] = curr
+		}
+		curr = nil
+	}
+
+	loadLoop := banks[0].LoadLoop
+	for _, bank := range banks {
+		if bank.LoadLoop < loadLoop {
+			loadLoop = bank.LoadLoop
+		}
+		for _, evt := range bank.GameEvents {
+			switch evt.EvtType.Name {
+			case EvtTypeBankSection:
+				done()
+				section = evt.Stringv("name")
+				if _, ok := keys[section]; !ok {
+					keys[section] = nil
+					sections = append(sections, evt)
+				}
+			case EvtTypeBankKey:
+				done()
+				curr = &writeOfKey{loop: evt.Loop(), evts: []s2prot.Event{evt}}
+			case EvtTypeBankValue:
+				if curr != nil {
+					curr.evts = append(curr.evts, evt)
+					if evt.Loop() > curr.loop {
+						curr.loop = evt.Loop()
+					}
+				}
+			case EvtTypeBankSignature:
+				done()
+			}
+		}
+		done()
+		section = ""
+	}
+
+	evts := []s2prot.Event{banks[0].GameEvents[0]} // "BankFile" event of the owner
+	for _, evt := range sections {
+		evts = append(evts, evt)
+		name := evt.Stringv("name")
+		for _, key := range keys[name] {
+			evts = append(evts, writes[SectionKey{name, key}].evts...)
+		}
+	}
+	ret := banks[0].withEvents(evts)
+	ret.LoadLoop = loadLoop
+	return ret
+}
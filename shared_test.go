@@ -0,0 +1,82 @@
+package bankrecover
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+)
+
+func TestNewSharedBanksByTeam(t *testing.T) {
+	teamSlot := func(userID int64, toon string, teamID int64) s2prot.Struct {
+		s := testSlot(userID, toon, rep.ControlHuman)
+		s["teamId"] = teamID
+		return s
+	}
+	r := testRep(
+		[]s2prot.Struct{
+			teamSlot(0, "1-S2-1-1", 0),
+			teamSlot(1, "1-S2-1-2", 0),
+			teamSlot(2, "1-S2-1-3", 1),
+		},
+		[]s2prot.Struct{
+			testPlayer("A", 1, rep.ControlHuman),
+			testPlayer("B", 2, rep.ControlHuman),
+			testPlayer("C", 3, rep.ControlHuman),
+		},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Shared"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Gold", "type", int64(BankValueTypeInt), "data", "10"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Wood", "type", int64(BankValueTypeInt), "data", "5"),
+		testEvt(testEvtTypeBankSignature, 0, 0, "signature", []interface{}{int64(0xAB)}),
+		testEvt(testEvtTypeBankFile, 1, 0, "name", "Shared"),
+		testEvt(testEvtTypeBankSection, 1, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 1, 0, "name", "Gold", "type", int64(bankValueTypeNext), "data", ""),
+		testEvt(testEvtTypeBankValue, 1, 0, "name", "Gold", "type", int64(BankValueTypeInt), "data", "20"),
+		testEvt(testEvtTypeBankSection, 1, 0, "name", "T"),
+		testEvt(testEvtTypeBankKey, 1, 0, "name", "Stone", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankFile, 2, 0, "name", "Shared"),
+		testEvt(testEvtTypeBankSection, 2, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 2, 0, "name", "Gold", "type", int64(BankValueTypeInt), "data", "99"),
+	)
+
+	if SharedControl(r) {
+		t.Errorf("Expected no shared control")
+	}
+	r.InitData.GameDescription.GameOptions = rep.GameOptions{Struct: s2prot.Struct{"advancedSharedControl": true}}
+	if !SharedControl(r) {
+		t.Errorf("Expected shared control")
+	}
+
+	banks := NewSharedBanksByTeam(r)
+	if len(banks) != 2 || len(banks[1]) != 1 || len(banks[2]) != 1 {
+		t.Fatalf("Expected a shared bank of each of 2 teams, got: %v", banks)
+	}
+	flat := func(bank *Bank) []string {
+		var ret []string
+		for _, section := range bank.Sections() {
+			for _, key := range section.Keys {
+				for _, v := range key.Values {
+					ret = append(ret, fmt.Sprint(section.Name, ".", key.Name, "=", v.Data))
+				}
+			}
+		}
+		return ret
+	}
+
+	merged := banks[1]["Shared"]
+	if exp, got := []string{"S.Gold=20", "S.Wood=5", "T.Stone=1"}, flat(merged); !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+	if got := merged.UserSlot.UserID(); got != 0 {
+		t.Errorf("Expected the merged bank to be owned by user %v, got: %v", 0, got)
+	}
+	if sig := merged.SignatureBytes(); sig != nil {
+		t.Errorf("Expected no signature, got: %v", sig)
+	}
+	if exp, got := []string{"S.Gold=99"}, flat(banks[2]["Shared"]); !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
@@ -0,0 +1,60 @@
+package bankrecover
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ComputeSignature returns the signature of this bank as the game computes it when the map of the toon handle
+// 'authorToon' saves it for the player of the owner slot: the SHA-1 of the signed string, in upper-case hex.
+// The author toon handle is usually that of AuthorToon.
+//
+// The signed string is the author toon handle, the player toon handle and the bank name, followed by
+// each section name with each of its key names and for each value its element name, type attribute name
+// and data as written out, sections and keys ordered by name byte-wise.
+// Sections and keys are taken as the game keeps them, see collapseSections; a bank with no sections signs
+// its handles and name only. Data is signed as recorded, e.g. a fixed value is signed as the string the game wrote,
+// not as the number it encodes.
+//
+// An error is returned if a toon handle is empty, e.g. of an anonymized replay, or if a value is of an
+// unknown type, which WriteTo drops.
+func (bank *Bank) ComputeSignature(authorToon string) (string, error) {
+	return bank.computeSignature(authorToon, bank.UserSlot.ToonHandle())
+}
+
+// computeSignature returns the signature of this bank as ComputeSignature does, signed for the player of the toon handle 'playerToon'.
+func (bank *Bank) computeSignature(authorToon, playerToon string) (string, error) {
+	if authorToon == "" {
+		return "", errors.New("compute signature: empty author toon handle")
+	}
+	if playerToon == "" {
+		return "", errors.New("compute signature: empty player toon handle")
+	}
+	sb := &strings.Builder{}
+	sb.WriteString(authorToon)
+	sb.WriteString(playerToon)
+	sb.WriteString(bank.Name)
+
+	sections := collapseSections(bank.Sections())
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].Name < sections[j].Name })
+	for _, section := range sections {
+		sb.WriteString(section.Name)
+		keys := section.Keys
+		sort.SliceStable(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+		for _, key := range keys {
+			sb.WriteString(key.Name)
+			for _, v := range key.Values {
+				if v.Type < BankValueTypeFixed || v.Type > BankValueTypeText {
+					return "", fmt.Errorf("compute signature: unknown value type %d of key %q in section %q", int(v.Type), key.Name, section.Name)
+				}
+				sb.WriteString(v.Name)
+				sb.WriteString(v.Type.String())
+				sb.WriteString(v.Data)
+			}
+		}
+	}
+	return fmt.Sprintf("%X", sha1.Sum([]byte(sb.String()))), nil
+}
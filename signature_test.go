@@ -0,0 +1,99 @@
+package bankrecover
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+)
+
+func TestComputeSignature(t *testing.T) {
+	sum := func(s string) string { return fmt.Sprintf("%X", sha1.Sum([]byte(s))) }
+	owned := func(bank *Bank) *Bank {
+		bank.UserSlot = rep.Slot{Struct: s2prot.Struct{"toonHandle": "1-S2-1-2"}}
+		return bank
+	}
+
+	cases := []struct {
+		bank *Bank
+		exp  string // signed string expected, empty if an error is
+	}{
+		{owned(testBank("Empty")), "1-S2-1-11-S2-1-2Empty"},
+		{owned(testBankFixture()), "1-S2-1-11-S2-1-2Fixture" +
+			"Items" + "Sword" + "Valueflag1" +
+			"Stats" + "Hero" + "ValuestringRaynor" + "Level" + "Valueint12"},
+		// Repeated sections and keys signed as kept, the last value of a key
+		{owned(testBank("Repeated",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeFixed), "data", "1.5000"),
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeFixed), "data", "2.0000"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "Empty"),
+		)), "1-S2-1-11-S2-1-2Repeated" + "S" + "Empty" + "K" + "Valuefixed2.0000"},
+		{owned(testBank("Unknown",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(9), "data", "1"),
+		)), ""},
+		{testBank("Anonymous"), ""},
+	}
+	for i, c := range cases {
+		got, err := c.bank.ComputeSignature("1-S2-1-1")
+		if c.exp == "" {
+			if err == nil {
+				t.Errorf("[%d] Expected error, got: %v", i, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] Unexpected error: %v", i, err)
+		} else if exp := sum(c.exp); got != exp {
+			t.Errorf("[%d] Expected: %v, got: %v", i, exp, got)
+		}
+	}
+
+	if _, err := owned(testBank("Empty")).ComputeSignature(""); err == nil {
+		t.Errorf("Expected error of empty author")
+	}
+}
+
+func TestWriteToWithOptionsSignatureAuthor(t *testing.T) {
+	unsigned := testBank("Unsigned", testEvt(testEvtTypeBankSection, 0, 0, "name", "S"))
+	cases := []struct {
+		bank *Bank
+		exp  string // signed string expected
+	}{
+		{testBankFixture(), "1-S2-1-12-S2-1-7Fixture" +
+			"Items" + "Sword" + "Valueflag1" +
+			"Stats" + "Hero" + "ValuestringRaynor" + "Level" + "Valueint12"},
+		{unsigned, "1-S2-1-12-S2-1-7Unsigned" + "S"},
+	}
+	for i, c := range cases {
+		buf := &bytes.Buffer{}
+		opts := WriteOptions{Owner: "2-S2-1-7", SignatureAuthor: "1-S2-1-1", EmptySignature: EmptySignatureOmit}
+		if _, err := c.bank.WriteToWithOptions(buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		exp := fmt.Sprintf(`<Signature value="%X"/>`, sha1.Sum([]byte(c.exp)))
+		if got := buf.String(); strings.Count(got, "<Signature") != 1 || !strings.Contains(got, exp) {
+			t.Errorf("[%d] Expected: %v, got: %v", i, exp, got)
+		}
+	}
+
+	if _, err := unsigned.WriteToWithOptions(&bytes.Buffer{}, WriteOptions{SignatureAuthor: "1-S2-1-1"}); err == nil {
+		t.Errorf("Expected error of empty owner")
+	}
+
+	// Owner defaults to the toon handle of the owner slot
+	owned := testBankFixture()
+	owned.UserSlot = rep.Slot{Struct: s2prot.Struct{"toonHandle": "2-S2-1-7"}}
+	buf := &bytes.Buffer{}
+	if _, err := owned.WriteToWithOptions(buf, WriteOptions{SignatureAuthor: "1-S2-1-1"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if exp := fmt.Sprintf(`<Signature value="%X"/>`, sha1.Sum([]byte(cases[0].exp))); !strings.Contains(buf.String(), exp) {
+		t.Errorf("Expected: %v, got: %v", exp, buf.String())
+	}
+}
@@ -0,0 +1,82 @@
+package bankrecover
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultPathTemplate is the layout banks are saved and archived in, see ExpandPathTemplate.
+const DefaultPathTemplate = "{index}__{toon}/{bank}.SC2Bank"
+
+// ExpandPathTemplate returns the path of the bank 'bank' of the player of index 'index'
+// laid out after the template 'tmpl', e.g. "{map}/{toon}/{bank}.SC2Bank".
+// Supported placeholders are:
+//
+//	{index}  the index of the player
+//	{toon}   the toon handle of the player
+//	{author} the toon handle of the map author, see Bank.AuthorToon
+//	{name}   the name of the player, see Bank.PlayerName
+//	{bank}   the name of the bank
+//	{map}    the title of the map
+//	{team}   the team of the player, 1-based
+//
+// Values are sanitized with the rules of SanitizeBankFilename, so they never introduce path separators;
+// empty values expand to nothing, though a path element left empty by them is "_".
+// The returned path is slash-separated. An error is returned for unknown or unterminated placeholders.
+func ExpandPathTemplate(tmpl string, bank *Bank, index int) (string, error) {
+	elems := strings.Split(tmpl, "/")
+	for i, elem := range elems {
+		expanded, err := expandPathElem(elem, bank, index)
+		if err != nil {
+			return "", fmt.Errorf("path template %q: %v", tmpl, err)
+		}
+		if expanded == "" && elem != "" {
+			expanded = "_"
+		}
+		elems[i] = expanded
+	}
+	return strings.Join(elems, "/"), nil
+}
+
+// expandPathElem returns the path element template 'elem' expanded as ExpandPathTemplate does.
+func expandPathElem(elem string, bank *Bank, index int) (string, error) {
+	sb := &strings.Builder{}
+	for rest := elem; rest != ""; {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			sb.WriteString(rest)
+			break
+		}
+		sb.WriteString(rest[:i])
+		rest = rest[i:]
+		j := strings.IndexByte(rest, '}')
+		if j < 0 {
+			return "", fmt.Errorf("unterminated placeholder")
+		}
+		var value string
+		switch placeholder := rest[:j+1]; placeholder {
+		case "{index}":
+			value = strconv.Itoa(index)
+		case "{toon}":
+			value = bank.UserSlot.ToonHandle()
+		case "{author}":
+			value = bank.AuthorToon()
+		case "{name}":
+			value = bank.PlayerName()
+		case "{bank}":
+			value = bank.Name
+		case "{map}":
+			value = bank.r.Details.Title()
+		case "{team}":
+			value = strconv.FormatInt(bank.UserSlot.TeamID()+1, 10)
+		default:
+			return "", fmt.Errorf("unknown placeholder %s", placeholder)
+		}
+		if value != "" {
+			sb.WriteString(sanitizePathElem(value))
+		}
+		rest = rest[j+1:]
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,70 @@
+package bankrecover
+
+import (
+	"testing"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+func TestExpandPathTemplate(t *testing.T) {
+	bank := testBank("Saves/RPG")
+	bank.r = &repm.Rep{
+		Details: rep.Details{Struct: s2prot.Struct{"title": "Map: Reborn"}},
+		InitData: rep.NewInitData(s2prot.Struct{"syncLobbyState": s2prot.Struct{
+			"gameDescription": s2prot.Struct{"mapAuthorName": "2-S2-1-7"},
+		}}),
+	}
+	bank.UserSlot = rep.Slot{Struct: s2prot.Struct{"toonHandle": "2-S2-1-42", "teamId": int64(1)}}
+	bank.Player.Name = "Zera"
+
+	cases := []struct {
+		tmpl string
+		exp  string
+		err  bool
+	}{
+		{"{index}__{toon}/{bank}.SC2Bank", "3__2-S2-1-42/Saves_RPG.SC2Bank", false},
+		{"{map}/{team}/{name}/{bank}.SC2Bank", "Map_ Reborn/2/Zera/Saves_RPG.SC2Bank", false},
+		{"{toon}/Banks/{author}/{bank}.SC2Bank", "2-S2-1-42/Banks/2-S2-1-7/Saves_RPG.SC2Bank", false},
+		{"banks", "banks", false},
+		{"{toon", "", true},
+		{"{player}/{bank}", "", true},
+	}
+	for _, c := range cases {
+		got, err := ExpandPathTemplate(c.tmpl, bank, 3)
+		if (err != nil) != c.err {
+			t.Errorf("[%s] Expected error: %v, got: %v", c.tmpl, c.err, err)
+		}
+		if got != c.exp {
+			t.Errorf("[%s] Expected: %v, got: %v", c.tmpl, c.exp, got)
+		}
+	}
+}
+
+func TestExpandPathTemplateEmpty(t *testing.T) {
+	bank := testBank("B")
+	bank.r = &repm.Rep{}
+	bank.UserSlot = rep.Slot{Struct: s2prot.Struct{}} // anonymized, no toon handle
+
+	cases := []struct {
+		tmpl string
+		exp  string
+	}{
+		{DefaultPathTemplate, "0__/B.SC2Bank"}, // as laid out before templates
+		{"{toon}/{bank}.SC2Bank", "_/B.SC2Bank"},
+		{"{map}{toon}", "_"},
+	}
+	for _, c := range cases {
+		got, err := ExpandPathTemplate(c.tmpl, bank, 0)
+		if err != nil {
+			t.Errorf("[%s] Expected no error, got: %v", c.tmpl, err)
+		}
+		if got != c.exp {
+			t.Errorf("[%s] Expected: %v, got: %v", c.tmpl, c.exp, got)
+		}
+	}
+	if got := archivePath(0, bank); got != "0__/B.SC2Bank" {
+		t.Errorf("Expected: %v, got: %v", "0__/B.SC2Bank", got)
+	}
+}
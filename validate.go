@@ -0,0 +1,216 @@
+package bankrecover
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+// isValidName tells if 'name' is valid as a bank section or key name:
+// it is not empty and is made of ASCII letters, digits and underscores only,
+// the character set SC2 accepts for bank identifiers.
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateNames checks each section and key name of this bank against the identifier rules of SC2:
+// a name must not be empty and may contain ASCII letters, digits and underscores only.
+// A bank with any other name won't load in-game.
+// Returns the list of violations, empty if all names are valid.
+func (bank *Bank) ValidateNames() []error {
+	var errs []error
+	for _, section := range bank.Sections() {
+		if !isValidName(section.Name) {
+			errs = append(errs, fmt.Errorf("invalid section name %q", section.Name))
+		}
+		for _, key := range section.Keys {
+			if !isValidName(key.Name) {
+				errs = append(errs, fmt.Errorf("invalid key name %q in section %q", key.Name, section.Name))
+			}
+		}
+	}
+	return errs
+}
+
+// validateTypes checks that each value of this bank is of a known value type.
+// WriteTo cannot name the attribute of values of other types.
+func (bank *Bank) validateTypes() []error {
+	var errs []error
+	for _, section := range bank.Sections() {
+		for _, key := range section.Keys {
+			for _, v := range key.Values {
+				if v.Type < BankValueTypeFixed || v.Type > BankValueTypeText {
+					errs = append(errs, fmt.Errorf("unknown value type %d of key %q in section %q", int(v.Type), key.Name, section.Name))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// validateStructure checks that the content events of this bank are in the order the game streams them:
+// no key precedes every section, no value precedes every key, and the value of a type-7 key comes next.
+// The section/key model leaves out events breaking the order, so WriteTo doesn't write them.
+func (bank *Bank) validateStructure() []error {
+	var errs []error
+	var section, key string
+	inSection, inKey, pending := false, false, false
+	for _, evt := range bank.GameEvents {
+		switch evt.EvtType.Name {
+		case EvtTypeBankSection:
+			if pending {
+				errs = append(errs, fmt.Errorf("value of key %q in section %q missing", key, section))
+			}
+			section, inSection, inKey, pending = evt.Stringv("name"), true, false, false
+		case EvtTypeBankKey:
+			if pending {
+				errs = append(errs, fmt.Errorf("value of key %q in section %q missing", key, section))
+			}
+			if !inSection {
+				errs = append(errs, fmt.Errorf("key %q of no section", evt.Stringv("name")))
+				inKey, pending = false, false
+				continue
+			}
+			key, inKey = evt.Stringv("name"), true
+			typ, _, ok := bankEventValue(evt)
+			pending = ok && typ == bankValueTypeNext
+		case EvtTypeBankValue:
+			if !inKey {
+				errs = append(errs, fmt.Errorf("value %q of no key", evt.Stringv("name")))
+				continue
+			}
+			typ, _, _ := bankEventValue(evt)
+			pending = typ == bankValueTypeNext
+		case EvtTypeBankSignature:
+			if pending {
+				errs = append(errs, fmt.Errorf("value of key %q in section %q missing", key, section))
+			}
+			pending = false
+		}
+	}
+	if pending {
+		errs = append(errs, fmt.Errorf("value of key %q in section %q missing", key, section))
+	}
+	return errs
+}
+
+// validatePoints checks that each point value of this bank holds the game coordinates "<x>,<y>".
+func (bank *Bank) validatePoints() []error {
+	var errs []error
+	for _, section := range bank.Sections() {
+		for _, key := range section.Keys {
+			for _, v := range key.Values {
+				if v.Type != BankValueTypePoint {
+					continue
+				}
+				coords := strings.Split(v.Data, ",")
+				valid := len(coords) == 2
+				for _, c := range coords {
+					if _, err := strconv.ParseFloat(c, 64); err != nil {
+						valid = false
+					}
+				}
+				if !valid {
+					errs = append(errs, fmt.Errorf("invalid point %q of key %q in section %q", v.Data, key.Name, section.Name))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// validateSignature checks that each element of the signature of this bank is a byte,
+// so the signature written out in hex is of 2 digits per element.
+func (bank *Bank) validateSignature() []error {
+	var errs []error
+	for _, evt := range bank.GameEvents {
+		if evt.EvtType.Name != EvtTypeBankSignature {
+			continue
+		}
+		for i, v := range evt.Array("signature") {
+			if n, ok := v.(int64); !ok || n < 0 || n > 0xff {
+				errs = append(errs, fmt.Errorf("invalid signature element %v at %d", v, i))
+			}
+		}
+	}
+	return errs
+}
+
+// Validate checks this bank for what keeps banks from loading in-game:
+// invalid names as ValidateNames tells, content events out of the order the game streams them,
+// values of unknown types, point values not of two coordinates, and signature elements not being bytes.
+// Returns the list of problems, empty if the bank is valid.
+//
+// Unit values are not checked, how the game lays their data out is not known for sure.
+func (bank *Bank) Validate() []error {
+	var errs []error
+	errs = append(errs, bank.ValidateNames()...)
+	errs = append(errs, bank.validateStructure()...)
+	errs = append(errs, bank.validateTypes()...)
+	errs = append(errs, bank.validatePoints()...)
+	errs = append(errs, bank.validateSignature()...)
+	return errs
+}
+
+// ValidationReport is what RecoverAndValidate found wrong with the banks of a replay.
+type ValidationReport struct {
+	Banks    []BankReport // Reports of all banks, ordered by player index, then by bank name
+	Warnings []string     // Warnings met while recovering banks, e.g. events of unknown users
+}
+
+// BankReport is the validation result of a bank.
+type BankReport struct {
+	Index  int     // Index of the player of the bank, as in the result of NewBanksFromReplay
+	Bank   *Bank   // The bank validated
+	Errors []error // Problems Validate found
+	Signed bool    // Tells if the bank has a non-empty signature
+}
+
+// OK tells if nothing was found wrong: there were no warnings, and all banks are valid and signed.
+func (report *ValidationReport) OK() bool {
+	if len(report.Warnings) > 0 {
+		return false
+	}
+	for _, br := range report.Banks {
+		if len(br.Errors) > 0 || !br.Signed {
+			return false
+		}
+	}
+	return true
+}
+
+// RecoverAndValidate returns all banks of all players in the replay 'r' as NewBanksFromReplay does,
+// along with a report of the validation of each bank and the warnings met while recovering.
+// Warnings go into the report instead of Log.
+// An error is returned if game events of 'r' were not decoded, there is nothing to recover from then.
+func RecoverAndValidate(r *repm.Rep) (banks []map[string]*Bank, report ValidationReport, err error) {
+	if r.GameEvts == nil {
+		return nil, report, errors.New("recover banks: game events not decoded")
+	}
+	banks = recoverBanks(r, 0, LoggerFunc(func(format string, v ...interface{}) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(format, v...))
+	}), nil, nil)
+	for iPlayer, playerBanks := range banks {
+		for _, name := range sortedBankNames(playerBanks) {
+			bank := playerBanks[name]
+			report.Banks = append(report.Banks, BankReport{
+				Index:  iPlayer,
+				Bank:   bank,
+				Errors: bank.Validate(),
+				Signed: len(bank.SignatureBytes()) > 0,
+			})
+		}
+	}
+	return banks, report, nil
+}
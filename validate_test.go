@@ -0,0 +1,146 @@
+package bankrecover
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/icza/s2prot"
+	"github.com/icza/s2prot/rep"
+	"github.com/nanitefactory/sc2bankrecover/repm"
+)
+
+func TestIsValidName(t *testing.T) {
+	cases := []struct {
+		name  string
+		valid bool
+	}{
+		{"Stats", true},
+		{"hero_level_2", true},
+		{"", false},
+		{"two words", false},
+		{"dash-ed", false},
+		{"점수", false},
+	}
+
+	for _, c := range cases {
+		if got := isValidName(c.name); got != c.valid {
+			t.Errorf("Expected: %v, got: %v", c.valid, got)
+		}
+	}
+}
+
+func TestValidateNames(t *testing.T) {
+	bank := testBank("Names",
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "Bad Section"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "Good", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "bad?", "type", int64(BankValueTypeInt), "data", "1"),
+	)
+	if got := len(bank.ValidateNames()); got != 2 {
+		t.Errorf("Expected: %v violations, got: %v", 2, got)
+	}
+	if got := len(testBankFixture().ValidateNames()); got != 0 {
+		t.Errorf("Expected: %v violations, got: %v", 0, got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		bank *Bank
+		errs int
+	}{
+		{testBankFixture(), 0},
+		{testBank("Empty"), 0},
+		{testBank("Stray",
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+			testEvt(testEvtTypeBankValue, 0, 0, "name", "V", "type", int64(BankValueTypeInt), "data", "1"),
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankValue, 0, 0, "name", "V", "type", int64(BankValueTypeInt), "data", "1"),
+		), 3},
+		{testBank("Missing",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(bankValueTypeNext), "data", ""),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "L", "type", int64(bankValueTypeNext), "data", ""),
+		), 2},
+		{testBank("Split",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(bankValueTypeNext), "data", ""),
+			testEvt(testEvtTypeBankValue, 0, 0, "name", "K", "type", int64(BankValueTypeText), "data", "long"),
+		), 0},
+		{testBank("Types",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "Odd", "type", int64(9), "data", "1"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "Point", "type", int64(BankValueTypePoint), "data", "12.5,30"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "Flat", "type", int64(BankValueTypePoint), "data", "12.5"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "NaP", "type", int64(BankValueTypePoint), "data", "x,y"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "Unit", "type", int64(BankValueTypeUnit), "data", "Marine"),
+		), 3},
+		{testBank("Signature",
+			testEvt(testEvtTypeBankSignature, 0, 0, "signature", []interface{}{int64(0), int64(255), int64(256), int64(-1)}),
+		), 2},
+	}
+	for i, c := range cases {
+		if got := c.bank.Validate(); len(got) != c.errs {
+			t.Errorf("[%d] Expected: %v problems, got: %v", i, c.errs, got)
+		}
+	}
+}
+
+func TestSaveAsFileValidateOnSave(t *testing.T) {
+	defer func(v bool) { ValidateOnSave = v }(ValidateOnSave)
+	bad := testBank("Bad", testEvt(testEvtTypeBankSection, 0, 0, "name", "Bad Section"))
+	name := filepath.Join(t.TempDir(), "Bad.SC2Bank")
+
+	ValidateOnSave = false
+	if err := bad.SaveAsFile(name); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	ValidateOnSave = true
+	if err := bad.SaveAsFile(name); err == nil {
+		t.Errorf("Expected error of invalid bank")
+	}
+	if err := testBankFixture().SaveAsFile(name); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestRecoverAndValidate(t *testing.T) {
+	r := testRep(
+		[]s2prot.Struct{testSlot(0, "1-S2-1-1", rep.ControlHuman)},
+		[]s2prot.Struct{testPlayer("A", 1, rep.ControlHuman)},
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Good"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeInt), "data", "1"),
+		testEvt(testEvtTypeBankSignature, 0, 0, "signature", []interface{}{int64(1)}),
+		testEvt(testEvtTypeBankFile, 0, 0, "name", "Bad"),
+		testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+		testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(9), "data", "1"),
+		testEvt(testEvtTypeBankFile, 7, 0, "name", "Stray"),
+	)
+
+	banks, report, err := RecoverAndValidate(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(banks) != 1 || len(banks[0]) != 2 {
+		t.Errorf("Expected: %v banks, got: %v", 2, banks)
+	}
+	if len(report.Warnings) != 1 {
+		t.Errorf("Expected: %v warnings, got: %v", 1, report.Warnings)
+	}
+	if len(report.Banks) != 2 {
+		t.Fatalf("Expected: %v bank reports, got: %v", 2, len(report.Banks))
+	}
+	if bad := report.Banks[0]; bad.Bank.Name != "Bad" || len(bad.Errors) != 1 || bad.Signed {
+		t.Errorf("Unexpected report of bank Bad: %+v", bad)
+	}
+	if good := report.Banks[1]; good.Bank.Name != "Good" || len(good.Errors) != 0 || !good.Signed {
+		t.Errorf("Unexpected report of bank Good: %+v", good)
+	}
+	if report.OK() {
+		t.Errorf("Expected report not to be OK")
+	}
+
+	if _, _, err := RecoverAndValidate(&repm.Rep{}); err == nil {
+		t.Errorf("Expected error without game events")
+	}
+}
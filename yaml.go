@@ -0,0 +1,53 @@
+package bankrecover
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// yamlReserved are the plain scalars YAML parsers may read as other than strings, case-insensitive.
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "null": true,
+}
+
+// yamlName returns 'name' as a YAML mapping key, left plain if it is a valid bank identifier
+// that can't be read as other than a string, double-quoted otherwise.
+func yamlName(name string) string {
+	if isValidName(name) && !(name[0] >= '0' && name[0] <= '9') && !yamlReserved[strings.ToLower(name)] {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// WriteYAML writes out this bank to the writer 'w' as a YAML mapping of section -> key -> {type, value},
+// where type is the attribute name of the value type as in .SC2Bank files and value is a double-quoted string.
+// Sections and keys written more than once are merged as the game keeps them, a key holding the values of its last write.
+// Keys lacking a value map to an empty mapping, as do sections having no keys.
+func (bank *Bank) WriteYAML(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	sections := collapseSections(bank.Sections())
+	if len(sections) == 0 {
+		buf.WriteString("{}\n")
+	}
+	for _, section := range sections {
+		if len(section.Keys) == 0 {
+			fmt.Fprintf(buf, "%s: {}\n", yamlName(section.Name))
+			continue
+		}
+		fmt.Fprintf(buf, "%s:\n", yamlName(section.Name))
+		for _, key := range section.Keys {
+			if len(key.Values) == 0 {
+				fmt.Fprintf(buf, "  %s: {}\n", yamlName(key.Name))
+				continue
+			}
+			v := key.Values[0]
+			fmt.Fprintf(buf, "  %s:\n    type: %s\n    value: %s\n", yamlName(key.Name), v.Type, strconv.Quote(v.Data))
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,54 @@
+package bankrecover
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteYAML(t *testing.T) {
+	cases := []struct {
+		bank *Bank
+		exp  string
+	}{
+		{testBank("Empty"), "{}\n"},
+		{testBankFixture(), `Stats:
+  Level:
+    type: int
+    value: "12"
+  Hero:
+    type: string
+    value: "Raynor"
+Items:
+  Sword:
+    type: flag
+    value: "1"
+`},
+		{testBank("Odd",
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeText), "data", "a"),
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "yes"),
+			testEvt(testEvtTypeBankSection, 0, 0, "name", "S"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "1st", "type", int64(BankValueTypeInt), "data", "1"),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "K", "type", int64(BankValueTypeText), "data", "c\n\"d\""),
+			testEvt(testEvtTypeBankKey, 0, 0, "name", "Pending", "type", int64(bankValueTypeNext), "data", ""),
+		), `S:
+  K:
+    type: text
+    value: "c\n\"d\""
+  "1st":
+    type: int
+    value: "1"
+  Pending: {}
+"yes": {}
+`},
+	}
+	for i, c := range cases {
+		buf := &bytes.Buffer{}
+		if err := c.bank.WriteYAML(buf); err != nil {
+			t.Errorf("[%d] Unexpected error: %v", i, err)
+		}
+		if got := buf.String(); got != c.exp {
+			t.Errorf("[%d] Expected: %v, got: %v", i, c.exp, got)
+		}
+	}
+}